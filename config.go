@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+)
+
+// defaultConfigFile is read from the working directory if the -config flag
+// is not set.
+const defaultConfigFile = ".aws-add-secrets.json"
+
+// commandLineOnly are flags that cannot be set in a config file: ones selecting
+// the program mode or confirming destructive actions must always be explicit.
+var commandLineOnly = map[string]bool{
+	"config":          true,
+	"delete":          true,
+	"export":          true,
+	"yes":             true,
+	"recovery-window": true,
+}
+
+// applyConfig sets flags from a JSON config file unless they were already set
+// on the command line. Config is an object with flag names as keys, i.e.
+//
+//	{"region": "eu-west-1", "concurrency": 4, "tag": ["team=web", "env=prod"]}
+//
+// Arrays are only useful for flags that can be repeated. Flags listed in
+// commandLineOnly are an error. If mustExist is false, a missing file is not
+// an error.
+func applyConfig(fs *flag.FlagSet, name string, mustExist bool) error {
+	b, err := ioutil.ReadFile(name)
+	if err != nil {
+		if !mustExist && errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var cfg map[string]interface{}
+	if err := dec.Decode(&cfg); err != nil {
+		return fmt.Errorf("config %s: %w", name, err)
+	}
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	keys := make([]string, 0, len(cfg))
+	for k := range cfg {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		f := fs.Lookup(k)
+		if f == nil {
+			return fmt.Errorf("config %s: unsupported flag %q", name, k)
+		}
+		if commandLineOnly[k] {
+			return fmt.Errorf("config %s: flag %q can only be set on the command line", name, k)
+		}
+		if set[k] {
+			continue
+		}
+		values, ok := cfg[k].([]interface{})
+		if !ok {
+			values = []interface{}{cfg[k]}
+		}
+		for _, v := range values {
+			s, err := configString(v)
+			if err != nil {
+				return fmt.Errorf("config %s: flag %q: %w", name, k, err)
+			}
+			if err := f.Value.Set(s); err != nil {
+				return fmt.Errorf("config %s: flag %q: %w", name, k, err)
+			}
+		}
+	}
+	return nil
+}
+
+// configString returns string form of a scalar JSON value, as it would be
+// given on the command line.
+func configString(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case json.Number:
+		return v.String(), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	}
+	return "", errors.New("value must be a string, number, or boolean")
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestApplyConfig(t *testing.T) {
+	const config = `{
+		"region": "eu-west-1",
+		"concurrency": 4,
+		"verbose": true,
+		"tag": ["team=web", "env=prod"],
+		"only": "myapp/*"
+	}`
+	for _, tc := range []struct {
+		name string
+		argv []string
+		want map[string]string // flag values by name
+	}{
+		{
+			name: "config",
+			want: map[string]string{
+				"region":      "eu-west-1",
+				"concurrency": "4",
+				"verbose":     "true",
+				"tag":         "team=web,env=prod",
+				"only":        "myapp/*",
+				"exists":      "fail",
+			},
+		},
+		{
+			name: "command line",
+			argv: []string{"-region", "us-east-1", "-concurrency", "1", "-verbose=false", "-only", "other/*"},
+			want: map[string]string{
+				"region":      "us-east-1",
+				"concurrency": "1",
+				"verbose":     "false",
+				"tag":         "team=web,env=prod",
+				"only":        "other/*",
+			},
+		},
+		{
+			name: "repeated flag replaced",
+			argv: []string{"-tag", "owner=me"},
+			want: map[string]string{
+				"tag":    "owner=me",
+				"region": "eu-west-1",
+			},
+		},
+		{
+			name: "repeated flag set twice",
+			argv: []string{"-tag", "owner=me", "-tag", "env=dev"},
+			want: map[string]string{"tag": "owner=me,env=dev"},
+		},
+		{
+			name: "default",
+			argv: []string{"-exists", "skip"},
+			want: map[string]string{"exists": "skip", "max-retries": "3"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			fs := flag.NewFlagSet("aws-add-secrets", flag.ContinueOnError)
+			var args runArgs
+			defineFlags(fs, &args)
+			if err := fs.Parse(tc.argv); err != nil {
+				t.Fatal(err)
+			}
+			if err := applyConfig(fs, writeFile(t, "config.json", config), true); err != nil {
+				t.Fatal(err)
+			}
+			for name, want := range tc.want {
+				if got := fs.Lookup(name).Value.String(); got != want {
+					t.Errorf("-%s is %q, want %q", name, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestApplyConfigErrors(t *testing.T) {
+	for _, tc := range []struct {
+		config, err string
+	}{
+		{`{"config": "other.json"}`, `flag "config" can only be set on the command line`},
+		{`{"yes": true, "recovery-window": 0}`, `flag "recovery-window" can only be set on the command line`},
+		{`{"yes": true}`, `flag "yes" can only be set on the command line`},
+		{`{"delete": true}`, `flag "delete" can only be set on the command line`},
+		{`{"export": true}`, `flag "export" can only be set on the command line`},
+		{`{"no-such-flag": 1}`, `unsupported flag "no-such-flag"`},
+		{`{"concurrency": "many"}`, `flag "concurrency": parse error`},
+		{`{"tag": [{"team": "web"}]}`, `flag "tag": value must be a string, number, or boolean`},
+		{`{"region": }`, "invalid character"},
+	} {
+		fs := flag.NewFlagSet("aws-add-secrets", flag.ContinueOnError)
+		fs.SetOutput(io.Discard)
+		var args runArgs
+		defineFlags(fs, &args)
+		err := applyConfig(fs, writeFile(t, "config.json", tc.config), true)
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("config %s: got error %v, want one containing %q", tc.config, err, tc.err)
+		}
+	}
+	fs := flag.NewFlagSet("aws-add-secrets", flag.ContinueOnError)
+	missing := filepath.Join(t.TempDir(), "missing.json")
+	if err := applyConfig(fs, missing, false); err != nil {
+		t.Errorf("missing optional config: %v", err)
+	}
+	if err := applyConfig(fs, missing, true); err == nil {
+		t.Error("missing config file set with -config accepted")
+	}
+}
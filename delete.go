@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+)
+
+// Secrets Manager limits on the recovery window of deleted secrets
+const (
+	minRecoveryWindow = 7
+	maxRecoveryWindow = 30
+)
+
+// deleteSecrets schedules deletion of secrets and writes their names with
+// deletion dates to w. If recoveryWindow is 0, secrets are deleted without
+// recovery, otherwise it's the number of days they can be restored within.
+// It returns the number of secrets deleted.
+func deleteSecrets(ctx context.Context, svc secretsClient, w io.Writer, secrets []secret, recoveryWindow int) (int, error) {
+	for i, s := range secrets {
+		in := &secretsmanager.DeleteSecretInput{SecretId: aws.String(s.Name)}
+		if recoveryWindow == 0 {
+			in.ForceDeleteWithoutRecovery = aws.Bool(true)
+		} else {
+			in.RecoveryWindowInDays = aws.Int64(int64(recoveryWindow))
+		}
+		out, err := svc.DeleteSecretWithContext(ctx, in)
+		if err != nil {
+			return i, fmt.Errorf("delete secret %q: %w", s.Name, err)
+		}
+		logSecret(levelVerbose, s.displayName(), "deleted", nil)
+		fmt.Fprintf(w, "%s\t%s\n", s.Name, aws.TimeValue(out.DeletionDate).UTC().Format(time.RFC3339))
+	}
+	return len(secrets), nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+)
+
+// Statuses reported by diffSecrets
+const (
+	diffNew                = "new"
+	diffUnchanged          = "unchanged"
+	diffValueChanged       = "value-changed"
+	diffDescriptionChanged = "description-changed"
+)
+
+// diffSecrets compares secrets with the existing ones without modifying
+// anything, and writes status of each secret to w. Secret values are never
+// written, only whether they differ. It returns the number of secrets that
+// are new or differ from the existing ones.
+func diffSecrets(ctx context.Context, svc secretsClient, w io.Writer, secrets []secret) (int, error) {
+	var changed int
+	for _, s := range secrets {
+		status, err := diffSecret(ctx, svc, s)
+		if err != nil {
+			return changed, err
+		}
+		if status != diffUnchanged {
+			changed++
+		}
+		fmt.Fprintf(w, "%s\t%s\n", s.Name, status)
+	}
+	return changed, nil
+}
+
+// diffSecret returns comma-separated list of differences between s and the
+// existing secret, or a single diffNew or diffUnchanged status.
+func diffSecret(ctx context.Context, svc secretsClient, s secret) (string, error) {
+	desc, err := describeSecret(ctx, svc, s.Name)
+	if err != nil {
+		return "", err
+	}
+	if desc == nil {
+		return diffNew, nil
+	}
+	out, err := svc.GetSecretValueWithContext(ctx, &secretsmanager.GetSecretValueInput{
+		SecretId: desc.ARN,
+	})
+	if err != nil {
+		return "", fmt.Errorf("get secret %q value: %w", s.Name, err)
+	}
+	var diffs []string
+	if s.binary != nil {
+		if out.SecretString != nil || !bytes.Equal(out.SecretBinary, s.binary) {
+			diffs = append(diffs, diffValueChanged)
+		}
+	} else if out.SecretString == nil || *out.SecretString != s.Value {
+		diffs = append(diffs, diffValueChanged)
+	}
+	if aws.StringValue(desc.Description) != s.Description {
+		diffs = append(diffs, diffDescriptionChanged)
+	}
+	if len(diffs) == 0 {
+		return diffUnchanged, nil
+	}
+	return strings.Join(diffs, ","), nil
+}
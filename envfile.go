@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+// parseEnv reads secrets from a .env file of KEY=value lines, using keys as
+// secret names. Blank lines and lines starting with # are ignored, as well as
+// the "export " prefix before keys. Values can be quoted with double quotes,
+// which support \n, \r, \t, \", and \\ escapes, or with single quotes, taken
+// literally; both can span multiple lines. Unquoted values end at " #".
+func parseEnv(rd io.Reader, dir string, opts readOptions) ([]secret, error) {
+	data, err := ioutil.ReadAll(rd)
+	if err != nil {
+		return nil, err
+	}
+	lines := strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n")
+	var out []secret
+	for i := 0; i < len(lines); i++ {
+		s := secret{line: i + 1}
+		line := strings.TrimLeft(lines[i], " \t")
+		if strings.TrimSpace(line) == "" || line[0] == '#' {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+		eq := strings.IndexByte(line, '=')
+		if eq == -1 {
+			return nil, fmt.Errorf("line %d: want KEY=value", s.line)
+		}
+		s.Name = strings.TrimSpace(line[:eq])
+		value := strings.TrimLeft(line[eq+1:], " \t")
+		if value == "" || value[0] != '"' && value[0] != '\'' {
+			if j := strings.Index(value, " #"); j != -1 {
+				value = value[:j]
+			}
+			s.Value = strings.TrimSpace(value)
+		} else {
+			var v strings.Builder
+			quote, rest := value[0], value[1:]
+			for {
+				n, ok := unquoteEnv(&v, rest, quote)
+				if ok {
+					if tail := strings.TrimSpace(rest[n+1:]); tail != "" && tail[0] != '#' {
+						return nil, fmt.Errorf("line %d: unexpected text after quoted value", i+1)
+					}
+					break
+				}
+				if i++; i == len(lines) {
+					return nil, fmt.Errorf("line %d: unterminated quoted value", s.line)
+				}
+				v.WriteByte('\n')
+				rest = lines[i]
+			}
+			s.Value = v.String()
+		}
+		if err := s.prepare(dir, opts); err != nil {
+			return nil, fmt.Errorf("line %d: %w", s.line, err)
+		}
+		out = append(out, s)
+	}
+	return out, nil
+}
+
+// unquoteEnv writes s to b up to the closing quote, decoding escapes if quote
+// is a double quote. It returns index of the closing quote in s, and reports
+// whether it was found.
+func unquoteEnv(b *strings.Builder, s string, quote byte) (int, bool) {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == quote:
+			return i, true
+		case c == '\\' && quote == '"' && i+1 < len(s):
+			i++
+			switch s[i] {
+			case 'n':
+				b.WriteByte('\n')
+			case 'r':
+				b.WriteByte('\r')
+			case 't':
+				b.WriteByte('\t')
+			case '"', '\\':
+				b.WriteByte(s[i])
+			default:
+				b.WriteByte('\\')
+				b.WriteByte(s[i])
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+)
+
+// exportSecrets writes secrets with names starting with prefix to w as CSV in
+// the format accepted as program input. If noValues is true, only names and
+// descriptions are written. Binary secrets are written to the value_base64
+// column. Values with delimiters, quotes, or line breaks are quoted, so that
+// the output reads back the same.
+func exportSecrets(ctx context.Context, svc secretsClient, w io.Writer, prefix string, noValues bool) error {
+	in := &secretsmanager.ListSecretsInput{}
+	if prefix != "" {
+		in.Filters = []*secretsmanager.Filter{{
+			Key:    aws.String(secretsmanager.FilterNameStringTypeName),
+			Values: []*string{&prefix},
+		}}
+	}
+	var list []*secretsmanager.SecretListEntry
+	err := svc.ListSecretsPagesWithContext(ctx, in, func(out *secretsmanager.ListSecretsOutput, _ bool) bool {
+		for _, e := range out.SecretList {
+			// name filter is case-insensitive and also matches words
+			// inside names, so check the actual prefix
+			if strings.HasPrefix(aws.StringValue(e.Name), prefix) {
+				list = append(list, e)
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return fmt.Errorf("list secrets: %w", err)
+	}
+	sort.Slice(list, func(i, j int) bool { return *list[i].Name < *list[j].Name })
+	rows := make([][]string, 0, len(list))
+	var hasBinary bool
+	for _, e := range list {
+		if noValues {
+			rows = append(rows, []string{*e.Name, aws.StringValue(e.Description)})
+			continue
+		}
+		out, err := svc.GetSecretValueWithContext(ctx, &secretsmanager.GetSecretValueInput{
+			SecretId: e.ARN,
+		})
+		if err != nil {
+			return fmt.Errorf("get secret %q value: %w", *e.Name, err)
+		}
+		var value, binary string
+		if out.SecretBinary != nil {
+			binary = base64.StdEncoding.EncodeToString(out.SecretBinary)
+			hasBinary = true
+		} else {
+			value = aws.StringValue(out.SecretString)
+		}
+		rows = append(rows, []string{*e.Name, value, binary, aws.StringValue(e.Description)})
+	}
+	cw := csv.NewWriter(w)
+	switch {
+	case noValues:
+		cw.Write([]string{"name", "description"})
+	case hasBinary:
+		cw.Write([]string{"name", "value", "value_base64", "description"})
+	default:
+		cw.Write([]string{"name", "value", "description"})
+	}
+	for _, row := range rows {
+		if !noValues && !hasBinary {
+			row = []string{row[0], row[1], row[3]}
+		}
+		cw.Write(row)
+	}
+	cw.Flush()
+	return cw.Error()
+}
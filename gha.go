@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// Supported values of the -gha-format flag
+const (
+	ghaEnv  = "env"
+	ghaJSON = "json"
+	ghaStep = "step"
+)
+
+// ghaAction is the GitHub Action that -gha-format=step output configures.
+const ghaAction = "aws-actions/aws-secretsmanager-get-secrets@v2"
+
+// ghaWriter writes variable names and ARNs of secrets for a GitHub Actions
+// workflow in one of the -gha-format formats: "NAME: ARN" lines of an env
+// block, a JSON object collected and written on flush, or a workflow step
+// fetching secrets into environment variables. The step header is written
+// along with the first secret, so nothing is written if there are none.
+type ghaWriter struct {
+	w       io.Writer
+	format  string // one of ghaEnv, ghaJSON, ghaStep
+	started bool
+	names   []string
+	arns    []string
+}
+
+// write adds a secret with a given variable name and ARN.
+func (g *ghaWriter) write(name, arn string) {
+	switch g.format {
+	case ghaJSON:
+		g.names = append(g.names, name)
+		g.arns = append(g.arns, arn)
+	case ghaStep:
+		if !g.started {
+			fmt.Fprintf(g.w, "- uses: %s\n  with:\n    secret-ids: |\n", ghaAction)
+			g.started = true
+		}
+		fmt.Fprintf(g.w, "      %s,%s\n", name, arn)
+	default:
+		// JSON strings are valid YAML double-quoted scalars
+		v, _ := json.Marshal(arn)
+		fmt.Fprintf(g.w, "%s: %s\n", name, v)
+	}
+}
+
+// flush writes the JSON object collected with -gha-format=json.
+func (g *ghaWriter) flush() error {
+	if g.format != ghaJSON {
+		return nil
+	}
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, []byte(jsonObject(g.names, g.arns)), "", "\t"); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(g.w, "%s\n", buf.Bytes())
+	return err
+}
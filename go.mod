@@ -1,8 +1,15 @@
 module github.com/artyom/aws-add-secrets
 
-go 1.15
+go 1.20
 
 require (
 	github.com/artyom/csvstruct v1.0.0
-	github.com/aws/aws-sdk-go v1.35.12
+	github.com/aws/aws-sdk-go v1.55.5
+	golang.org/x/term v0.15.0
+	golang.org/x/time v0.5.0
+)
+
+require (
+	github.com/jmespath/go-jmespath v0.4.0 // indirect
+	golang.org/x/sys v0.15.0 // indirect
 )
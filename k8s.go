@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// maxK8sNameLength is the maximum length of a Kubernetes object name, which
+// must be a DNS subdomain.
+const maxK8sNameLength = 253
+
+// k8sNames derives unique Kubernetes object names from secret names.
+type k8sNames map[string]bool
+
+// name returns a valid Kubernetes object name for the secret name, which is
+// different from all names returned before: "myapp/DB_password" becomes
+// myapp-db-password, and repeated ones get -2, -3, etc. suffixes.
+func (seen k8sNames) name(secretName string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(secretName) {
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '.' {
+			b.WriteRune(r)
+			continue
+		}
+		b.WriteByte('-')
+	}
+	// names must start and end with an alphanumeric character
+	base := strings.Trim(b.String(), "-.")
+	if base == "" {
+		base = "secret"
+	}
+	if len(base) > maxK8sNameLength-4 {
+		// leave room for a suffix
+		base = strings.TrimRight(base[:maxK8sNameLength-4], "-.")
+	}
+	name := base
+	for i := 2; seen[name]; i++ {
+		name = base + "-" + strconv.Itoa(i)
+	}
+	seen[name] = true
+	return name
+}
+
+// writeExternalSecret writes an ExternalSecret manifest of the External
+// Secrets Operator for the secret to w, as a YAML document fetching the
+// secret from store into a Kubernetes secret with a given name. The secret
+// value is stored under the variable name of the secret, see secret.varName.
+func writeExternalSecret(w io.Writer, name, store string, s secret, arn string) {
+	fmt.Fprintf(w, "---\n# %s\n", arn)
+	fmt.Fprint(w, "apiVersion: external-secrets.io/v1beta1\nkind: ExternalSecret\n")
+	fmt.Fprintf(w, "metadata:\n  name: %s\n", name)
+	fmt.Fprintf(w, "spec:\n  secretStoreRef:\n    name: %s\n    kind: SecretStore\n", yamlString(store))
+	fmt.Fprintf(w, "  target:\n    name: %s\n", name)
+	fmt.Fprintf(w, "  data:\n  - secretKey: %s\n    remoteRef:\n      key: %s\n", yamlString(s.varName()), yamlString(s.Name))
+	if s.JSONKey != "" {
+		fmt.Fprintf(w, "      property: %s\n", yamlString(s.JSONKey))
+	}
+}
+
+// yamlString returns s as a double-quoted YAML scalar. JSON strings are valid
+// YAML ones, so this never needs YAML-specific escapes.
+func yamlString(s string) string {
+	b, err := json.Marshal(s)
+	if err != nil {
+		panic(err)
+	}
+	return string(b)
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+)
+
+// Levels of diagnostic logging
+const (
+	levelQuiet = iota
+	levelNormal
+	levelVerbose
+)
+
+var logLevel = levelNormal
+
+// logJSON makes diagnostic logs JSON lines instead of plain text.
+var logJSON bool
+
+// logRecord is a single line of the JSON diagnostic log.
+type logRecord struct {
+	Time   string `json:"time"`
+	Level  string `json:"level"`
+	Secret string `json:"secret,omitempty"`
+	Event  string `json:"event,omitempty"`
+	Msg    string `json:"msg,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// logInfo logs a message unless logging is set to levelQuiet.
+func logInfo(format string, v ...interface{}) {
+	logMessage(levelNormal, format, v...)
+}
+
+// logDebug logs a message only if logging is set to levelVerbose.
+func logDebug(format string, v ...interface{}) {
+	logMessage(levelVerbose, format, v...)
+}
+
+// logError logs an error regardless of the logging level.
+func logError(err error) {
+	if logJSON {
+		writeRecord(logRecord{Level: levelName(levelQuiet), Error: err.Error()})
+		return
+	}
+	log.Print(err)
+}
+
+// logSecret logs an event related to a single secret, like it being created,
+// with an optional error. Secret values must never be logged.
+func logSecret(level int, name, event string, err error) {
+	if level > logLevel {
+		return
+	}
+	if logJSON {
+		r := logRecord{Level: levelName(level), Secret: name, Event: event}
+		if err != nil {
+			r.Error = err.Error()
+		}
+		writeRecord(r)
+		return
+	}
+	if err != nil {
+		log.Printf("secret %q %s: %v", name, event, err)
+		return
+	}
+	log.Printf("secret %q %s", name, event)
+}
+
+func logMessage(level int, format string, v ...interface{}) {
+	if level > logLevel {
+		return
+	}
+	if logJSON {
+		writeRecord(logRecord{Level: levelName(level), Msg: fmt.Sprintf(format, v...)})
+		return
+	}
+	log.Printf(format, v...)
+}
+
+func writeRecord(r logRecord) {
+	r.Time = time.Now().UTC().Format(time.RFC3339Nano)
+	b, err := json.Marshal(r)
+	if err != nil {
+		panic(err)
+	}
+	log.Print(string(b))
+}
+
+// levelName returns level name used in JSON logs.
+func levelName(level int) string {
+	switch level {
+	case levelQuiet:
+		return "error"
+	case levelVerbose:
+		return "debug"
+	}
+	return "info"
+}
@@ -1,136 +1,3364 @@
-// Command aws-add-secrets loads secrets from a CSV file to an AWS Secrets
-// Manager.
+// Command aws-add-secrets loads secrets from CSV, JSON, or .env files to an
+// AWS Secrets Manager.
 //
-// CSV file must have a header, which is inspected to find "name", "value", and
-// an optional "description" columns.
+// CSV file must have a header, which is inspected to find "name", "value",
+// and optional metadata columns like "description" or "tags".
 //
 // It outputs ARNs of each secret created, or a JSON lines suitable for the
 // "secrets" section of ECS container task definition if run with an -env flag.
+// Input formats, columns, other output formats, and modes are described in
+// the usage text printed with the -h flag.
 package main
 
 import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
 	"context"
+	"crypto/sha256"
+	"encoding/base64"
 	"encoding/csv"
 	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"log"
+	"math/rand"
+	"net/url"
 	"os"
+	"os/signal"
+	"path"
 	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"syscall"
+	"text/template"
+	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/artyom/csvstruct"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/arn"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/endpoints"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"golang.org/x/term"
+	"golang.org/x/time/rate"
 )
 
 func main() {
 	log.SetFlags(0)
-	envJson := flag.Bool("env", false, "output json record for each secret created instead of ARN (for ECS task definition)")
+	var args runArgs
+	configFile := defineFlags(flag.CommandLine, &args)
 	flag.Parse()
-	if err := run(flag.Arg(0), *envJson); err != nil {
-		log.Fatal(err)
+	args.files = flag.Args()
+	name, mustExist := defaultConfigFile, false
+	if *configFile != "" {
+		name, mustExist = *configFile, true
+	}
+	// config errors are logged as JSON with -log-json on the command line
+	logJSON = args.logJSON
+	if err := applyConfig(flag.CommandLine, name, mustExist); err != nil {
+		logError(err)
+		os.Exit(exitFailure)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := run(ctx, args); err != nil {
+		logError(err)
+		var perr *partialError
+		if errors.As(err, &perr) {
+			os.Exit(exitPartial)
+		}
+		os.Exit(exitFailure)
 	}
 }
 
-func run(file string, envJson bool) error {
-	if file == "" {
-		return errors.New("input file missing")
+// defineFlags defines program flags on fs, storing their values in args, and
+// returns the value of the -config flag.
+func defineFlags(fs *flag.FlagSet, args *runArgs) *string {
+	args.exists = existsFail
+	fs.BoolVar(&args.envJson, "env", false, "output json record for each secret created instead of ARN (for ECS task definition)")
+	fs.BoolVar(&args.envArray, "env-array", false, "output single json array of records for all secrets created (for ECS task definition)")
+	fs.StringVar(&args.envNameField, "env-name-field", defaultEnvNameField, "JSON `key` of variable names in -env and -env-array records")
+	fs.StringVar(&args.envValueField, "env-value-field", defaultEnvValueField, "JSON `key` of ARNs in -env and -env-array records")
+	fs.BoolVar(&args.strictEnvNames, "strict-env-names", false, "fail on env_name values that aren't valid variable names, instead of fixing them up")
+	fs.StringVar(&args.envTrimPrefix, "env-trim-prefix", "", "derive variable names from the whole rest of secret names starting with this `prefix`, instead of the last part")
+	fs.BoolVar(&args.dotenv, "dotenv", false, "output NAME=ARN line for each secret created (.env file format)")
+	fs.BoolVar(&args.cfn, "cfn", false, "output single json object mapping logical ids to dynamic references of all secrets created (for CloudFormation templates)")
+	fs.BoolVar(&args.jsonReport, "json", false, "output single json document with results for all secrets and a summary")
+	fs.BoolVar(&args.terraform, "terraform", false, "output terraform resource stub and import command for each secret created")
+	fs.BoolVar(&args.k8sExternalSecret, "k8s-externalsecret", false, "output External Secrets Operator ExternalSecret manifest for each secret created")
+	fs.StringVar(&args.k8sSecretStore, "k8s-secret-store", "aws-secrets-manager", "`name` of the SecretStore that -k8s-externalsecret manifests refer to")
+	fs.BoolVar(&args.gha, "gha", false, "output variable names and ARNs of secrets created for a GitHub Actions workflow, see -gha-format")
+	fs.StringVar(&args.ghaFormat, "gha-format", ghaEnv, "`format` of -gha output: "+ghaEnv+" for lines of an env block, "+
+		ghaJSON+" for an object mapping variable names to ARNs, or "+ghaStep+" for a step fetching secrets")
+	fs.BoolVar(&args.withName, "with-name", false, "output secret name before ARN, tab-separated")
+	fs.BoolVar(&args.versionID, "version-id", false, "also output version id of each secret: tab-separated after ARN, or as a versionId field of json records")
+	fs.StringVar(&args.exists, "exists", args.exists, "what to do if secret already exists: "+
+		existsFail+", "+existsSkip+", "+existsUpdate+" its value, "+existsReplace+
+		" its value, description, and tags, or "+existsMergeJSON+" JSON object values")
+	fs.BoolVar(&args.verify, "verify", false, "read back each stored secret value and fail if it differs from the input")
+	fs.BoolVar(&args.restore, "restore", false, "restore secrets scheduled for deletion, then store them as if they already existed")
+	fs.BoolVar(&args.idempotent, "idempotent", false, "derive request tokens from secret names and values, so that re-runs with the same input are idempotent")
+	fs.IntVar(&args.concurrency, "concurrency", 1, "number of secrets to create concurrently")
+	fs.IntVar(&args.maxRetries, "max-retries", 3, "max number of retries for throttled requests")
+	fs.IntVar(&args.batchSize, "batch-size", 0, "process secrets in batches of this size, 0 means a single batch")
+	fs.DurationVar(&args.batchPause, "batch-pause", 0, "sleep for this `duration` between -batch-size batches")
+	fs.Float64Var(&args.rate, "rate", 0, "max number of Secrets Manager requests per second, 0 means no limit")
+	fs.BoolVar(&args.rollback, "rollback", false, "on failure delete, without recovery, all secrets created by this run")
+	fs.BoolVar(&args.continueOnError, "continue-on-error", false, "keep processing remaining secrets after a failure, report all failures at the end")
+	fs.BoolVar(&args.trim, "trim", false, "trim leading and trailing whitespace from names, values, and descriptions")
+	fs.StringVar(&args.comment, "comment", "#", "CSV lines starting with this character are ignored, empty value disables comments")
+	fs.StringVar(&args.format, "format", "", "input format: "+formatCSV+", "+formatJSON+", or "+formatEnv+
+		", by default derived from the file extension")
+	fs.BoolVar(&args.interactiveValues, "interactive-values", false, "ask for secret values on the terminal instead of reading them from the input")
+	fs.StringVar(&args.jsonKeys, "json-keys", "", "store only these comma-separated `columns` as a single JSON object secret value, like -json-secret")
+	fs.BoolVar(&args.jsonSecret, "json-secret", false, "store all columns except name, secret_name, description, tags, env_name, key, json_key, kms_key, version_stages, overwrite, and rotation ones as a single JSON object secret value")
+	fs.BoolVar(&args.normalizeNewlines, "normalize-newlines", false, "convert \\r\\n and lone \\r line endings in values to \\n")
+	fs.BoolVar(&args.expand, "expand", false, "replace ${VAR} and $VAR in secret values with environment variables, fail on undefined ones")
+	fs.IntVar(&args.maxValueSize, "max-value-size", maxValueLength, "max secret value size in `bytes`")
+	fs.BoolVar(&args.gzip, "gzip", false, "input is gzip-compressed, implied for files with .gz extension")
+	fs.StringVar(&args.delimiter, "delimiter", ",", "CSV field delimiter, use \\t for tab")
+	fs.StringVar(&args.descriptionColumn, "description-column", "", "comma-separated CSV `columns` with secret descriptions instead of description, the first one present is used")
+	fs.BoolVar(&args.skipEmptyRows, "skip-empty-rows", false, "skip CSV rows with empty name and value instead of failing")
+	fs.BoolVar(&args.lazyQuotes, "lazy-quotes", false, "tolerate malformed quoting in CSV input")
+	fs.StringVar(&args.descriptionTemplate, "description-template", "", "`file` with a text/template making descriptions for secrets without one from CSV columns")
+	fs.StringVar(&args.description, "description", "", "default description for secrets without one, {name} is replaced with the secret name")
+	fs.BoolVar(&args.sort, "sort", false, "process secrets in name order instead of the input order")
+	fs.BoolVar(&args.progress, "progress", false, "report progress to stderr during the run as created N/total, counting skipped and updated secrets too")
+	fs.BoolVar(&args.stream, "stream", false, "flush output to stdout after each secret, for feedback during long runs")
+	fs.StringVar(&args.output, "output", "", "write output to this `file` instead of stdout")
+	fs.StringVar(&args.nameTransform, "name-transform", transformNone, "transform secret names as they're read: "+
+		transformNone+", "+transformLower+", "+transformUpper+", or "+transformSlug)
+	fs.StringVar(&args.prefix, "prefix", "", "prefix to add to all secret names, joined with /")
+	fs.BoolVar(&args.prefixFromFilename, "prefix-from-filename", false, "prefix secret names with the input file name without extension, joined with /")
+	fs.StringVar(&args.suffix, "suffix", "", "suffix to append to all secret names as is, i.e. -v2")
+	fs.IntVar(&args.maxNameLength, "max-name-length", maxNameLength, "maximum length of secret names with -prefix and -suffix applied")
+	fs.BoolVar(&args.truncateNames, "truncate-names", false, "shorten names longer than -max-name-length by hashing instead of failing")
+	fs.BoolVar(&args.allowDupEnv, "allow-dup-env", false, "only warn if multiple secrets map to the same variable name in -env, -dotenv, -k8s-externalsecret, or -gha output, or logical id in -cfn output")
+	fs.BoolVar(&args.allowDups, "allow-duplicates", false, "do not check input for duplicate secret names")
+	fs.DurationVar(&args.timeout, "timeout", 0, "abort run after this `duration`, 0 means no timeout")
+	fs.IntVar(&args.maxSecrets, "max-secrets", 0, "warn if the number of existing secrets plus new ones exceeds this limit, 0 disables the check")
+	fs.BoolVar(&args.strictQuota, "strict-quota", false, "fail instead of warning when -max-secrets limit would be exceeded")
+	fs.BoolVar(&args.interactive, "interactive", false, "list secrets and ask for confirmation before creating them, unless stdin is not a terminal")
+	fs.BoolVar(&args.dryRun, "dry-run", false, "only report what would be done, do not create any secrets")
+	fs.StringVar(&args.predictARN, "predict-arn", "", "output -env or -env-array records with ARNs predicted for this `region:account` without creating secrets")
+	fs.BoolVar(&args.validateOnly, "validate-only", false, "only validate input files and exit, without making any AWS calls")
+	fs.BoolVar(&args.diff, "diff", false, "only report how secrets differ from the existing ones, exit with non-zero status on differences")
+	fs.StringVar(&args.policyFile, "policy-file", "", "attach resource policy from this JSON `file` to all secrets")
+	fs.BoolVar(&args.blockPublic, "block-public-policy", true, "reject resource policies from -policy-file that allow broad access")
+	fs.StringVar(&args.kmsKey, "kms-key", "", "KMS `key` id, ARN, or alias to encrypt secrets without kms_key column set")
+	fs.Var(&args.only, "only", "only process secrets with names matching this `glob` pattern, can be repeated")
+	fs.Var(&args.exclude, "exclude", "skip secrets with names matching this `glob` pattern, can be repeated")
+	fs.Var(&args.tags, "tag", "add tag in `key=value` form to all secrets, can be repeated; value cannot contain =")
+	fs.StringVar(&args.tagsFile, "tags-file", "", "add tags from this JSON `file` with an object of string values to all secrets")
+	fs.Var(&args.replicas, "replica", "replicate secrets to this `region[:kms-key]`, can be repeated")
+	fs.BoolVar(&args.delete, "delete", false, "delete secrets listed in the file instead of creating them, requires -yes")
+	fs.IntVar(&args.recoveryWindow, "recovery-window", maxRecoveryWindow, "number of `days` deleted secrets can be restored within, 0 deletes without recovery")
+	fs.BoolVar(&args.yes, "yes", false, "confirm deletion of secrets with -delete")
+	fs.Func("export", "export secrets with names starting with this `prefix` as CSV instead of creating them", func(s string) error {
+		args.export, args.exportPrefix = true, s
+		return nil
+	})
+	fs.BoolVar(&args.noValues, "no-values", false, "only export secret names and descriptions, without values")
+	fs.StringVar(&args.region, "region", "", "AWS region to use instead of the one from environment or config")
+	fs.StringVar(&args.expectRegion, "expect-region", "", "fail unless AWS region in use, and the one of all secret ARNs, is this `region`")
+	fs.StringVar(&args.profile, "profile", "", "AWS shared config profile to use")
+	fs.StringVar(&args.credentialsFile, "credentials-file", "", "read AWS credentials from this shared credentials `file`")
+	fs.StringVar(&args.endpointURL, "endpoint-url", "", "send AWS requests to this `URL`, i.e. a local emulator like LocalStack (default $AWS_ENDPOINT_URL)")
+	fs.BoolVar(&args.verbose, "verbose", false, "log each step to stderr")
+	fs.BoolVar(&args.logJSON, "log-json", false, "log to stderr as JSON lines")
+	fs.BoolVar(&args.quiet, "quiet", false, "do not log anything except errors to stderr")
+	return fs.String("config", "", "read default flag values from this JSON `file` (default "+defaultConfigFile+" if it exists)")
+}
+
+type runArgs struct {
+	files             []string
+	envJson           bool
+	envArray          bool
+	envNameField      string
+	envValueField     string
+	envTrimPrefix     string
+	strictEnvNames    bool
+	dotenv            bool
+	cfn               bool
+	terraform         bool
+	k8sExternalSecret bool
+	k8sSecretStore    string
+	gha               bool
+	ghaFormat         string // one of ghaEnv, ghaJSON, ghaStep
+	jsonReport        bool
+	versionID         bool
+	withName          bool
+	exists            string // one of existsFail, existsSkip, existsUpdate, existsReplace, existsMergeJSON
+	restore           bool
+	dryRun            bool
+	validateOnly      bool
+	predictARN        string
+	interactive       bool
+	interactiveValues bool
+	diff              bool
+	tags              tagFlag // tags applied to all secrets
+	tagsFile          string
+	replicas          replicaFlag
+	only              globFlag
+	exclude           globFlag
+	region            string
+	expectRegion      string
+	profile           string
+
+	credentialsFile string
+	endpointURL     string
+	verbose         bool
+	logJSON         bool
+	quiet           bool
+	progress        bool
+
+	concurrency         int
+	maxRetries          int
+	rate                float64 // requests per second, 0 for no limit
+	batchSize           int
+	batchPause          time.Duration
+	rollback            bool
+	verify              bool
+	continueOnError     bool
+	idempotent          bool
+	allowDups           bool
+	allowDupEnv         bool
+	timeout             time.Duration
+	maxSecrets          int
+	strictQuota         bool
+	prefix              string
+	prefixFromFilename  bool
+	suffix              string
+	maxNameLength       int
+	truncateNames       bool
+	nameTransform       string // one of transformNone, transformLower, transformUpper, transformSlug
+	description         string
+	descriptionTemplate string
+	output              string
+	stream              bool
+	sort                bool
+	policyFile          string
+	kmsKey              string
+	blockPublic         bool
+	delimiter           string
+	lazyQuotes          bool
+	skipEmptyRows       bool
+	descriptionColumn   string
+	comment             string
+	trim                bool
+	format              string
+	jsonSecret          bool
+	jsonKeys            string
+	expand              bool
+	normalizeNewlines   bool
+	gzip                bool
+
+	maxValueSize int
+
+	export       bool // export secrets instead of creating them
+	exportPrefix string
+	noValues     bool
+
+	delete         bool // delete secrets instead of creating them
+	recoveryWindow int
+	yes            bool
+}
+
+// Supported values of the -exists flag
+const (
+	existsFail    = "fail"
+	existsSkip    = "skip"
+	existsUpdate  = "update"
+	existsReplace = "replace"
+
+	existsMergeJSON = "merge-json"
+)
+
+// Supported values of the -name-transform flag
+const (
+	transformNone  = "none"
+	transformLower = "lower"
+	transformUpper = "upper"
+	transformSlug  = "slug"
+)
+
+func run(ctx context.Context, args runArgs) error {
+	logJSON = args.logJSON
+	switch {
+	case args.quiet && args.verbose:
+		return errors.New("-quiet and -verbose flags are mutually exclusive")
+	case args.quiet && args.progress:
+		return errors.New("-quiet and -progress flags are mutually exclusive")
+	case args.quiet:
+		logLevel = levelQuiet
+	case args.verbose:
+		logLevel = levelVerbose
+	}
+	if args.export {
+		return runExport(ctx, args)
+	}
+	if err := checkArgs(args); err != nil {
+		return err
+	}
+	var arnPrefix string
+	if args.predictARN != "" {
+		var err error
+		if arnPrefix, err = predictedARNPrefix(args.predictARN); err != nil {
+			return fmt.Errorf("-predict-arn: %w", err)
+		}
 	}
-	secrets, err := readSecrets(file)
+	opts, err := newReadOptions(args)
 	if err != nil {
 		return err
 	}
-	if len(secrets) == 0 {
-		return errors.New("file has no secrets")
+	var policy string
+	if args.policyFile != "" {
+		if policy, err = readPolicy(args.policyFile); err != nil {
+			return err
+		}
+	}
+	if args.tagsFile != "" {
+		tags, err := readTagsFile(args.tagsFile)
+		if err != nil {
+			return err
+		}
+		args.tags = mergeTags(tags, args.tags)
 	}
-	sess, err := session.NewSession()
+	var descTemplate *template.Template
+	if args.descriptionTemplate != "" {
+		if descTemplate, err = parseDescriptionTemplate(args.descriptionTemplate); err != nil {
+			return err
+		}
+		opts.keepColumns = true
+	}
+	if args.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, args.timeout)
+		defer cancel()
+	}
+	secrets, sess, err := readInput(ctx, args, opts)
 	if err != nil {
 		return err
 	}
-	ctx := context.Background()
-	svc := secretsmanager.New(sess)
-	for _, s := range secrets {
-		out, err := svc.CreateSecretWithContext(ctx, &secretsmanager.CreateSecretInput{
-			Name:         &s.Name,
-			SecretString: &s.Value,
-			Description:  &s.Description,
-		})
+	if secrets, err = prepareSecrets(args, secrets, descTemplate); err != nil {
+		return err
+	}
+	if args.validateOnly {
+		logInfo("validated %d secrets", len(secrets))
+		return nil
+	}
+	if args.interactiveValues {
+		if err := promptValues(os.Stdin, os.Stderr, secrets, args.maxValueSize); err != nil {
+			return err
+		}
+	}
+	out, err := openOutput(args.output)
+	if err != nil {
+		return err
+	}
+	defer out.discard()
+	if args.dryRun {
+		if err := dryRun(ctx, args, out, secrets); err != nil {
+			return err
+		}
+		return out.commit()
+	}
+	if arnPrefix != "" {
+		if err := predictARNs(out, args, secrets, arnPrefix); err != nil {
+			return err
+		}
+		return out.commit()
+	}
+	if sess == nil {
+		if sess, err = newSession(args); err != nil {
+			return err
+		}
+	}
+	svc := newSecretsClient(sess)
+	if args.delete {
+		n, err := deleteSecrets(ctx, svc, out, secrets, args.recoveryWindow)
+		if err != nil {
+			if n != 0 {
+				return &partialError{err: err, changed: n}
+			}
+			return err
+		}
+		return out.commit()
+	}
+	if args.diff {
+		n, err := diffSecrets(ctx, svc, out, secrets)
+		if err != nil {
+			return err
+		}
+		if err := out.commit(); err != nil {
+			return err
+		}
+		if n != 0 {
+			return fmt.Errorf("%d of %d secrets are new or changed", n, len(secrets))
+		}
+		return nil
+	}
+	if args.interactive && isTerminal(os.Stdin) {
+		ok, err := confirm(os.Stdin, os.Stderr, secrets)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			logInfo("aborted, no secrets created")
+			return nil
+		}
+	}
+	if args.maxSecrets > 0 {
+		if err := checkQuota(ctx, svc, len(secrets), args.maxSecrets); err != nil {
+			if args.strictQuota {
+				return err
+			}
+			logInfo("warning: %v", err)
+		}
+	}
+	return createAll(ctx, args, svc, out, secrets, policy)
+}
+
+// checkArgs returns an error if args have unsupported values or combinations
+// of flags. It doesn't read any files.
+func checkArgs(args runArgs) error {
+	if len(args.files) == 0 {
+		return errors.New("input file missing")
+	}
+	switch args.exists {
+	case existsFail, existsSkip, existsUpdate, existsReplace, existsMergeJSON:
+	default:
+		return fmt.Errorf("unsupported -exists value: %q", args.exists)
+	}
+	switch args.nameTransform {
+	case transformNone, transformLower, transformUpper, transformSlug:
+	default:
+		return fmt.Errorf("unsupported -name-transform value: %q", args.nameTransform)
+	}
+	if args.concurrency < 1 {
+		return errors.New("-concurrency must be positive")
+	}
+	if args.maxValueSize < 1 {
+		return errors.New("-max-value-size must be positive")
+	}
+	if args.maxRetries < 0 {
+		return errors.New("-max-retries cannot be negative")
+	}
+	if args.maxNameLength < 1 || args.maxNameLength > maxNameLength {
+		return fmt.Errorf("-max-name-length must be from 1 to %d", maxNameLength)
+	}
+	if args.truncateNames && args.maxNameLength <= truncatedHashLength+1 {
+		return fmt.Errorf("-max-name-length must be longer than %d with -truncate-names", truncatedHashLength+1)
+	}
+	if args.rate < 0 {
+		return errors.New("-rate cannot be negative")
+	}
+	if args.batchSize < 0 || args.batchPause < 0 {
+		return errors.New("-batch-size and -batch-pause cannot be negative")
+	}
+	if args.batchPause != 0 && args.batchSize == 0 {
+		return errors.New("-batch-pause requires -batch-size")
+	}
+	if args.dryRun && args.diff {
+		return errors.New("-dry-run and -diff flags are mutually exclusive")
+	}
+	if args.validateOnly {
+		if args.dryRun || args.diff || args.delete {
+			return errors.New("-validate-only cannot be used with -dry-run, -diff, or -delete")
+		}
+		for _, file := range args.files {
+			if strings.HasPrefix(file, "s3://") {
+				return fmt.Errorf("-validate-only cannot read %s: S3 input requires AWS calls", file)
+			}
+		}
+	}
+	if args.predictARN != "" {
+		if !args.envJson && !args.envArray {
+			return errors.New("-predict-arn requires -env or -env-array")
+		}
+		if args.dryRun || args.diff || args.delete || args.validateOnly || args.interactiveValues || args.versionID {
+			return errors.New("-predict-arn cannot be used with -dry-run, -diff, -delete, -validate-only, -interactive-values, or -version-id")
+		}
+	}
+	if args.verify && args.exists == existsMergeJSON {
+		return fmt.Errorf("-verify cannot be used with -exists=%s", existsMergeJSON)
+	}
+	if args.continueOnError && args.rollback {
+		return errors.New("-continue-on-error and -rollback flags are mutually exclusive")
+	}
+	if args.delete {
+		if !args.yes {
+			return errors.New("-delete requires the -yes flag to confirm deletion")
+		}
+		if args.dryRun || args.diff {
+			return errors.New("-delete cannot be used with -dry-run or -diff")
+		}
+		if args.envJson || args.envArray || args.dotenv || args.cfn || args.terraform || args.k8sExternalSecret || args.gha || args.jsonReport || args.withName || args.versionID {
+			return errors.New("-delete cannot be used with -env, -env-array, -dotenv, -cfn, -terraform, -k8s-externalsecret, -gha, -json, -with-name, or -version-id")
+		}
+		if w := args.recoveryWindow; w != 0 && (w < minRecoveryWindow || w > maxRecoveryWindow) {
+			return fmt.Errorf("-recovery-window must be 0 or from %d to %d days", minRecoveryWindow, maxRecoveryWindow)
+		}
+	}
+	if args.stream && (args.envArray || args.cfn || args.gha && args.ghaFormat == ghaJSON || args.jsonReport || args.output != "") {
+		return errors.New("-stream cannot be used with -env-array, -cfn, -gha-format=json, -json, or -output")
+	}
+	if countTrue(args.envJson, args.envArray, args.dotenv, args.cfn, args.terraform, args.k8sExternalSecret, args.gha, args.jsonReport) > 1 {
+		return errors.New("only one of -env, -env-array, -dotenv, -cfn, -terraform, -k8s-externalsecret, -gha, -json flags can be used")
+	}
+	if args.versionID && countTrue(args.dotenv, args.cfn, args.terraform, args.k8sExternalSecret, args.gha, args.jsonReport) != 0 {
+		// -json reports always have version ids
+		return errors.New("-version-id cannot be used with -dotenv, -cfn, -terraform, -k8s-externalsecret, -gha, or -json")
+	}
+	if args.envNameField != defaultEnvNameField || args.envValueField != defaultEnvValueField {
+		if !args.envJson && !args.envArray {
+			return errors.New("-env-name-field and -env-value-field only apply to -env and -env-array output")
+		}
+		if args.envNameField == "" || args.envValueField == "" {
+			return errors.New("-env-name-field and -env-value-field cannot be empty")
+		}
+		if args.envNameField == args.envValueField {
+			return errors.New("-env-name-field and -env-value-field must differ")
+		}
+	}
+	if args.withName && countTrue(args.envJson, args.envArray, args.dotenv, args.cfn, args.terraform, args.k8sExternalSecret, args.gha, args.jsonReport) != 0 {
+		return errors.New("-with-name cannot be used with -env, -env-array, -dotenv, -cfn, -terraform, -k8s-externalsecret, -gha, or -json")
+	}
+	switch args.ghaFormat {
+	case ghaEnv, ghaJSON, ghaStep:
+	default:
+		return fmt.Errorf("unsupported -gha-format value: %q", args.ghaFormat)
+	}
+	if args.ghaFormat != ghaEnv && !args.gha {
+		return errors.New("-gha-format only applies to -gha output")
+	}
+	if args.k8sExternalSecret && args.k8sSecretStore == "" {
+		return errors.New("-k8s-secret-store cannot be empty")
+	}
+	if args.prefixFromFilename {
+		for _, file := range args.files {
+			if file == "-" {
+				return errors.New("-prefix-from-filename cannot be used with input from stdin")
+			}
+		}
+	}
+	if args.interactiveValues {
+		if args.delete || args.jsonSecret || args.jsonKeys != "" {
+			return errors.New("-interactive-values cannot be used with -delete, -json-secret, or -json-keys")
+		}
+		for _, file := range args.files {
+			if file == "-" {
+				return errors.New("-interactive-values cannot be used with input from stdin")
+			}
+		}
+		if !args.validateOnly && !isTerminal(os.Stdin) {
+			return errors.New("-interactive-values requires stdin to be a terminal")
+		}
+	}
+	if args.description != "" && args.descriptionTemplate != "" {
+		return errors.New("-description and -description-template flags are mutually exclusive")
+	}
+	return nil
+}
+
+// newReadOptions returns options for reading input files set with args.
+func newReadOptions(args runArgs) (readOptions, error) {
+	comma, err := parseDelimiter(args.delimiter)
+	if err != nil {
+		return readOptions{}, err
+	}
+	comment, err := parseComment(args.comment, comma)
+	if err != nil {
+		return readOptions{}, err
+	}
+	var jsonKeys []string
+	if args.jsonKeys != "" {
+		for _, key := range strings.Split(args.jsonKeys, ",") {
+			if key = strings.TrimSpace(key); key == "" {
+				return readOptions{}, errors.New("-json-keys has an empty column name")
+			}
+			jsonKeys = append(jsonKeys, key)
+		}
+	}
+	var descriptionColumns []string
+	if args.descriptionColumn != "" {
+		for _, col := range strings.Split(args.descriptionColumn, ",") {
+			if col = strings.ToLower(strings.TrimSpace(col)); col == "" {
+				return readOptions{}, errors.New("-description-column has an empty column name")
+			}
+			if col == "name" || (metadataColumns[col] && col != "description") || strings.HasPrefix(col, "value") {
+				return readOptions{}, fmt.Errorf("-description-column cannot be %q, it's used for other data", col)
+			}
+			descriptionColumns = append(descriptionColumns, col)
+		}
+	}
+	return readOptions{
+		comma:         comma,
+		comment:       comment,
+		trim:          args.trim,
+		nameTransform: args.nameTransform,
+		lazyQuotes:    args.lazyQuotes,
+		skipEmpty:     args.skipEmptyRows,
+		descColumns:   descriptionColumns,
+		jsonSecret:    args.jsonSecret || len(jsonKeys) != 0,
+		jsonKeys:      jsonKeys,
+		expand:        args.expand,
+		normNewlines:  args.normalizeNewlines,
+		strictEnv:     args.strictEnvNames,
+		maxValueSize:  args.maxValueSize,
+		kmsKey:        args.kmsKey,
+		namesOnly:     args.delete,
+		promptValues:  args.interactiveValues,
+	}, nil
+}
+
+// readPolicy reads a resource policy from a file and checks that it's a
+// valid JSON.
+func readPolicy(name string) (string, error) {
+	b, err := ioutil.ReadFile(name)
+	if err != nil {
+		return "", err
+	}
+	if !json.Valid(b) {
+		return "", fmt.Errorf("policy file %s is not a valid JSON", name)
+	}
+	return string(b), nil
+}
+
+// readTagsFile reads tags from a file with a JSON object with string values.
+func readTagsFile(name string) (tagList, error) {
+	b, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	var tags tagList
+	if err := json.Unmarshal(b, &tags); err != nil {
+		return nil, fmt.Errorf("tags file %s must have a JSON object with string values: %w", name, err)
+	}
+	return tags, nil
+}
+
+// parseDescriptionTemplate parses a template file set with
+// -description-template.
+func parseDescriptionTemplate(name string) (*template.Template, error) {
+	t, err := template.ParseFiles(name)
+	if err != nil {
+		return nil, fmt.Errorf("-description-template: %w", err)
+	}
+	return t.Option("missingkey=error"), nil
+}
+
+// readInput reads secrets from all input files. The session it returns is
+// the one created to read files from S3, nil if there are no such files.
+func readInput(ctx context.Context, args runArgs, opts readOptions) ([]secret, *session.Session, error) {
+	formats := make([]string, len(args.files))
+	for i, file := range args.files {
+		var err error
+		if formats[i], err = inputFormat(file, args.format); err != nil {
+			return nil, nil, err
+		}
+		if opts.jsonSecret && formats[i] != formatCSV {
+			return nil, nil, errors.New("-json-secret and -json-keys are only supported for CSV input")
+		}
+		if args.descriptionTemplate != "" && formats[i] != formatCSV {
+			return nil, nil, errors.New("-description-template is only supported for CSV input")
+		}
+	}
+	var err error
+	var sess *session.Session
+	var secrets []secret
+	for i, file := range args.files {
+		opts.format = formats[i]
+		opts.gzip = args.gzip || isGzipName(file)
+		var ss []secret
+		if strings.HasPrefix(file, "s3://") {
+			var bucket, key string
+			if bucket, key, err = parseS3URL(file); err != nil {
+				return nil, nil, err
+			}
+			if sess == nil {
+				if sess, err = newSession(args); err != nil {
+					return nil, nil, err
+				}
+			}
+			ss, err = readS3Secrets(ctx, sess, bucket, key, opts)
+		} else {
+			ss, err = readSecrets(file, opts)
+		}
+		if len(args.files) > 1 {
+			if err != nil {
+				return nil, nil, fmt.Errorf("%s: %w", file, err)
+			}
+			for j := range ss {
+				ss[j].file = file
+			}
+		}
 		if err != nil {
-			return fmt.Errorf("create secret %q: %w", s.Name, err)
+			return nil, nil, err
+		}
+		secrets = append(secrets, ss...)
+	}
+	if len(secrets) == 0 {
+		return nil, nil, errors.New("file has no secrets")
+	}
+	return secrets, sess, nil
+}
+
+// prepareSecrets changes names and descriptions of secrets read from input
+// files as set with args, and checks that they suit the selected output. It
+// returns the secrets left after filtering with -only and -exclude.
+func prepareSecrets(args runArgs, secrets []secret, descTemplate *template.Template) ([]secret, error) {
+	if args.envTrimPrefix != "" {
+		trimEnvPrefix(secrets, args.envTrimPrefix)
+	}
+	if args.suffix != "" {
+		if err := addSuffix(secrets, args.suffix); err != nil {
+			return nil, err
+		}
+	}
+	if args.prefixFromFilename {
+		for i := range secrets {
+			file := secrets[i].file
+			if file == "" {
+				file = args.files[0]
+			}
+			prefix, err := filenamePrefix(file)
+			if err != nil {
+				return nil, err
+			}
+			if err := addPrefix(secrets[i:i+1], prefix); err != nil {
+				return nil, fmt.Errorf("%s: %w", file, err)
+			}
+		}
+	}
+	if args.prefix != "" {
+		if err := addPrefix(secrets, args.prefix); err != nil {
+			return nil, err
+		}
+	}
+	if err := limitNameLengths(secrets, args.maxNameLength, args.truncateNames); err != nil {
+		return nil, err
+	}
+	if args.exists == existsMergeJSON && !args.delete && !args.interactiveValues {
+		for i := range secrets {
+			s := &secrets[i]
+			if _, ok := jsonObjectValue(s.Value); s.binary != nil || !ok {
+				return nil, fmt.Errorf("%s: secret %q value is not a JSON object, as -exists=%s requires",
+					s.position(), s.Name, existsMergeJSON)
+			}
+		}
+	}
+	if args.description != "" {
+		for i := range secrets {
+			if secrets[i].Description == "" {
+				secrets[i].Description = strings.ReplaceAll(args.description, "{name}", secrets[i].Name)
+			}
+		}
+	}
+	if descTemplate != nil {
+		for i := range secrets {
+			s := &secrets[i]
+			if s.Description != "" {
+				continue
+			}
+			var b strings.Builder
+			data := struct {
+				Name    string
+				Columns map[string]string
+			}{s.Name, s.columns}
+			if err := descTemplate.Execute(&b, data); err != nil {
+				return nil, fmt.Errorf("%s: -description-template: %w", s.position(), err)
+			}
+			s.Description = strings.TrimSpace(b.String())
+		}
+	}
+	if !args.allowDups {
+		if err := checkDuplicates(secrets); err != nil {
+			return nil, err
+		}
+	}
+	if len(args.only) != 0 || len(args.exclude) != 0 {
+		n := len(secrets)
+		secrets = filterSecrets(secrets, args.only, args.exclude)
+		logInfo("%d of %d secrets filtered out with -only and -exclude", n-len(secrets), n)
+		if len(secrets) == 0 {
+			return nil, errors.New("no secrets left after filtering")
+		}
+	}
+	if args.sort {
+		sort.SliceStable(secrets, func(i, j int) bool { return secrets[i].Name < secrets[j].Name })
+	}
+	if args.gha && args.ghaFormat == ghaStep {
+		for i := range secrets {
+			if s := &secrets[i]; s.JSONKey != "" {
+				return nil, fmt.Errorf("%s: secret %q has key set, which -gha-format=step doesn't support", s.position(), s.Name)
+			}
+		}
+	}
+	if args.envJson || args.envArray || args.dotenv || args.k8sExternalSecret || args.gha {
+		if err := checkEmptyNames(secrets, "variable name", (*secret).varName); err != nil {
+			return nil, err
+		}
+		if err := checkEnvNames(secrets, "variable names", (*secret).varName); err != nil {
+			if !args.allowDupEnv {
+				return nil, err
+			}
+			logInfo("warning: %v", err)
+		}
+	}
+	if args.cfn {
+		if err := checkEmptyNames(secrets, "logical ID", (*secret).cfnID); err != nil {
+			return nil, err
+		}
+		if err := checkEnvNames(secrets, "logical IDs", (*secret).cfnID); err != nil {
+			if !args.allowDupEnv {
+				return nil, err
+			}
+			logInfo("warning: %v", err)
+		}
+	}
+	return secrets, nil
+}
+
+// createAll creates secrets, or handles existing ones according to -exists,
+// and writes them to out in the output format selected by args. Policy is a
+// resource policy to attach to all secrets, empty for none.
+func createAll(ctx context.Context, args runArgs, svc secretsClient, out *output, secrets []secret, policy string) error {
+	for i := range secrets {
+		secrets[i].Tags = mergeTags(args.tags, secrets[i].Tags)
+		secrets[i].index = i
+	}
+	var mu sync.Mutex
+	var created []string // ARNs of secrets created by this run
+	var sum summary
+	var prog *progress
+	results := make([]*reportSecret, len(secrets)) // -json results by secret.index
+	copts := createOptions{
+		exists:     args.exists,
+		replicas:   args.replicas,
+		idempotent: args.idempotent,
+		restore:    args.restore,
+		maxRetries: args.maxRetries,
+	}
+	create := func(ctx context.Context, s secret) (outcome, error) {
+		logDebug("creating secret %q", s.displayName())
+		o, err := createSecret(ctx, svc, s, copts)
+		if err == nil && args.expectRegion != "" {
+			err = checkRegion(o.arn, args.expectRegion)
+		}
+		if err == nil && args.verify && o.status != statusSkipped {
+			err = verifySecret(ctx, svc, o, s)
+		}
+		if err == nil && o.status != statusSkipped && policy != "" {
+			err = putResourcePolicy(ctx, svc, o.arn, s.Name, policy, args.blockPublic)
+		}
+		if err == nil && o.status != statusSkipped && s.RotationLambdaARN != "" {
+			err = rotateSecret(ctx, svc, o.arn, s)
+		}
+		if err == nil && o.status == statusCreated && len(s.VersionStages) != 0 {
+			err = addVersionStages(ctx, svc, o, s)
+		}
+		switch {
+		case err == nil:
+			logSecret(levelNormal, s.displayName(), o.status, nil)
+		case !errors.Is(err, context.Canceled):
+			logSecret(levelVerbose, s.displayName(), "failed", err)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		sum.add(o, err)
+		if args.jsonReport && !errors.Is(err, context.Canceled) {
+			r := newReportSecret(s, o, err)
+			results[s.index] = &r
+		}
+		if prog != nil {
+			prog.add()
+		}
+		if o.status == statusCreated {
+			// even if a later step failed, the secret exists now
+			created = append(created, o.arn)
+		}
+		return o, err
+	}
+	// logged to stderr, so it's there with all output formats
+	defer func() { logInfo("%v", sum) }()
+	if args.progress {
+		prog = newProgress(len(secrets))
+		defer prog.finish()
+	}
+	f := newFormatter(args, out)
+	createErr := createBatches(ctx, args, secrets, create, f.write)
+	if err := createErr; err != nil && (!args.continueOnError || ctx.Err() != nil) {
+		switch ctx.Err() {
+		case context.DeadlineExceeded:
+			err = fmt.Errorf("timed out after %v: %w", args.timeout, err)
+		case context.Canceled:
+			err = fmt.Errorf("interrupted after creating %d secrets: %w", len(created), err)
+		}
+		changed := sum.updated + sum.replaced + len(created)
+		if args.rollback {
+			// run context may already be done
+			changed -= len(created) - rollback(context.Background(), svc, created)
+		}
+		if args.jsonReport {
+			// the report tells which secrets were processed, so it's
+			// output even though the run failed
+			if werr := writeReport(out, results, sum, err); werr != nil {
+				logError(werr)
+			} else if werr := out.commit(); werr != nil {
+				logError(werr)
+			}
+		}
+		if changed != 0 {
+			return &partialError{err: err, changed: changed}
+		}
+		return err
+	}
+	if err := f.flush(); err != nil {
+		return err
+	}
+	if args.jsonReport {
+		if err := writeReport(out, results, sum, nil); err != nil {
+			return err
+		}
+	}
+	if err := out.commit(); err != nil {
+		return err
+	}
+	if createErr != nil {
+		// with -continue-on-error secrets that succeeded are already output
+		err := fmt.Errorf("%d of %d secrets failed:\n%w", sum.failed, len(secrets), createErr)
+		if changed := sum.updated + sum.replaced + len(created); changed != 0 {
+			return &partialError{err: err, changed: changed}
+		}
+		return err
+	}
+	return nil
+}
+
+// formatter writes created secrets to the output in the format selected by
+// runArgs. Formats producing a single document, like -env-array or -cfn,
+// are collected and written on flush.
+type formatter struct {
+	args     runArgs
+	out      *output
+	envArray []ecsSecret
+	cfnIDs   []string
+	cfnRefs  []string
+	tfNames  terraformNames
+	k8sNames k8sNames
+	gha      *ghaWriter
+}
+
+func newFormatter(args runArgs, out *output) *formatter {
+	return &formatter{
+		args:     args,
+		out:      out,
+		tfNames:  make(terraformNames),
+		k8sNames: make(k8sNames),
+		gha:      &ghaWriter{w: out, format: args.ghaFormat},
+	}
+}
+
+// write writes a single secret with its outcome.
+func (f *formatter) write(s secret, o outcome) {
+	args, out := f.args, f.out
+	arn := o.arn
+	e := newEcsSecret(s, arn)
+	e.nameField, e.valueField = args.envNameField, args.envValueField
+	if args.versionID {
+		e.VersionID = o.versionID
+	}
+	switch {
+	case args.jsonReport:
+		// written once all secrets are processed
+	case args.envArray:
+		f.envArray = append(f.envArray, e)
+	case args.terraform:
+		writeTerraformResource(out, f.tfNames.name(s.Name), s, arn)
+	case args.k8sExternalSecret:
+		writeExternalSecret(out, f.k8sNames.name(s.Name), args.k8sSecretStore, s, arn)
+	case args.gha:
+		f.gha.write(e.Name, e.Value)
+	case args.cfn:
+		f.cfnIDs = append(f.cfnIDs, s.cfnID())
+		ref := "{{resolve:secretsmanager:" + arn
+		if s.JSONKey != "" {
+			ref += ":SecretString:" + s.JSONKey
+		}
+		f.cfnRefs = append(f.cfnRefs, ref+"}}")
+	case args.envJson:
+		fmt.Fprintln(out, toJson(e))
+	case args.dotenv:
+		fmt.Fprintf(out, "%s=%s\n", s.varName(), arn)
+	default:
+		if args.withName {
+			fmt.Fprintf(out, "%s\t", s.Name)
 		}
-		if envJson {
-			fmt.Println(toJson(s.Name, *out.ARN))
+		if args.versionID {
+			fmt.Fprintf(out, "%s\t%s\n", arn, o.versionID)
 		} else {
-			fmt.Println(*out.ARN)
+			fmt.Fprintln(out, arn)
+		}
+	}
+	if args.stream {
+		out.sync()
+	}
+}
+
+// flush writes formats collected by write.
+func (f *formatter) flush() error {
+	if f.args.envArray {
+		b, err := json.MarshalIndent(f.envArray, "", "\t")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(f.out, "%s\n", b)
+	}
+	if f.args.cfn {
+		var buf bytes.Buffer
+		if err := json.Indent(&buf, []byte(jsonObject(f.cfnIDs, f.cfnRefs)), "", "\t"); err != nil {
+			return err
 		}
+		fmt.Fprintf(f.out, "%s\n", buf.Bytes())
+	}
+	if f.args.gha {
+		return f.gha.flush()
 	}
 	return nil
 }
 
-type secret struct {
-	Name        string `csv:"name"`
-	Value       string `csv:"value"`
-	Description string `csv:"description"`
+// runExport writes existing secrets to the output as CSV.
+func runExport(ctx context.Context, args runArgs) error {
+	if len(args.files) != 0 {
+		return errors.New("input file cannot be used with -export")
+	}
+	sess, err := newSession(args)
+	if err != nil {
+		return err
+	}
+	out, err := openOutput(args.output)
+	if err != nil {
+		return err
+	}
+	defer out.discard()
+	if err := exportSecrets(ctx, newSecretsClient(sess), out, args.exportPrefix, args.noValues); err != nil {
+		return err
+	}
+	return out.commit()
+}
+
+// output is a destination for the primary program output.
+type output struct {
+	io.Writer
+	f    *os.File // temporary file, nil for stdout
+	name string   // final file name
+}
+
+// openOutput returns output writing to stdout if name is empty or "-".
+// Otherwise output writes to a temporary file which is only renamed to name
+// on commit, so that a failed run does not leave a partially written file.
+func openOutput(name string) (*output, error) {
+	if name == "" || name == "-" {
+		return &output{Writer: os.Stdout}, nil
+	}
+	f, err := os.CreateTemp(filepath.Dir(name), "."+filepath.Base(name)+".*")
+	if err != nil {
+		return nil, err
+	}
+	if err := f.Chmod(0644); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, err
+	}
+	return &output{Writer: f, f: f, name: name}, nil
+}
+
+// commit renames the temporary file to its final name.
+func (o *output) commit() error {
+	if o.f == nil {
+		return nil
+	}
+	if err := o.f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(o.f.Name(), o.name)
+}
+
+// sync commits written output to stable storage.
+func (o *output) sync() {
+	f := o.f
+	if f == nil {
+		f = os.Stdout
+	}
+	// fails on pipes and terminals, which are not buffered anyway
+	f.Sync()
+}
+
+// discard removes the temporary file unless it was already committed.
+func (o *output) discard() {
+	if o.f == nil {
+		return
+	}
+	o.f.Close()
+	os.Remove(o.f.Name())
+}
+
+// newSession creates AWS session, using region, profile, credentials file,
+// and endpoint URL from args if they are set. Endpoint URL defaults to the
+// AWS_ENDPOINT_URL environment variable. With args.rate set, Secrets Manager
+// requests made with the session wait for the rate limit.
+func newSession(args runArgs) (*session.Session, error) {
+	var cfg aws.Config
+	if args.region != "" {
+		cfg.Region = aws.String(args.region)
+	}
+	endpoint := args.endpointURL
+	if endpoint == "" {
+		endpoint = os.Getenv("AWS_ENDPOINT_URL")
+	}
+	if endpoint != "" {
+		cfg.Endpoint = aws.String(endpoint)
+		cfg.DisableSSL = aws.Bool(strings.HasPrefix(endpoint, "http://"))
+		// local emulators like LocalStack don't resolve bucket subdomains
+		cfg.S3ForcePathStyle = aws.Bool(true)
+	}
+	if args.credentialsFile != "" {
+		cfg.Credentials = credentials.NewSharedCredentials(args.credentialsFile, args.profile)
+	}
+	var sess *session.Session
+	var err error
+	if args.profile == "" {
+		sess, err = session.NewSession(&cfg)
+	} else {
+		sess, err = session.NewSessionWithOptions(session.Options{
+			Config:            cfg,
+			Profile:           args.profile,
+			SharedConfigState: session.SharedConfigEnable,
+		})
+	}
+	if err != nil {
+		return nil, err
+	}
+	region := aws.StringValue(sess.Config.Region)
+	if args.expectRegion != "" && region != args.expectRegion {
+		return nil, fmt.Errorf("using region %q, but -expect-region is %q", region, args.expectRegion)
+	}
+	logDebug("using region %q", region)
+	if args.rate > 0 {
+		limiter := rate.NewLimiter(rate.Limit(args.rate), 1)
+		// sign handlers run for each attempt, including retries
+		sess.Handlers.Sign.PushFront(func(r *request.Request) {
+			if r.ClientInfo.ServiceName != secretsmanager.ServiceName {
+				return
+			}
+			if err := limiter.Wait(r.Context()); err != nil {
+				r.Error = err
+			}
+		})
+	}
+	if endpoint != "" {
+		logDebug("using endpoint %q", endpoint)
+	}
+	return sess, nil
+}
+
+// checkRegion returns an error if ARN s is not in the region.
+func checkRegion(s, region string) error {
+	a, err := arn.Parse(s)
+	if err != nil {
+		return fmt.Errorf("parsing ARN %q: %w", s, err)
+	}
+	if a.Region != region {
+		return fmt.Errorf("ARN %s is in region %q, expected %q", s, a.Region, region)
+	}
+	return nil
+}
+
+// dryRun prints what would be done for each secret without making any
+// changes. If AWS region and credentials are available, it also checks whether
+// each secret already exists.
+func dryRun(ctx context.Context, args runArgs, w io.Writer, secrets []secret) error {
+	svc, err := dryRunClient(args)
+	if err != nil {
+		logInfo("not checking whether secrets exist: %v", err)
+	}
+	for _, s := range secrets {
+		action := "would create"
+		if svc != nil {
+			ok, err := secretExists(ctx, svc, s.Name)
+			if err != nil {
+				return err
+			}
+			if ok {
+				action = "exists, would " + existsMode(args.exists, s)
+			}
+		}
+		fmt.Fprintf(w, "%s\t%s\n", s.Name, action)
+	}
+	return nil
+}
+
+// predictedARNPrefix returns the ARN of a secret without its name for a
+// "region:account" pattern.
+func predictedARNPrefix(pattern string) (string, error) {
+	region, account, ok := strings.Cut(pattern, ":")
+	if !ok || region == "" {
+		return "", fmt.Errorf("%q is not in region:account format", pattern)
+	}
+	if len(account) != 12 || strings.Trim(account, "0123456789") != "" {
+		return "", fmt.Errorf("account %q is not a 12-digit AWS account id", account)
+	}
+	p, ok := endpoints.PartitionForRegion(endpoints.DefaultPartitions(), region)
+	if !ok {
+		return "", fmt.Errorf("unknown region %q", region)
+	}
+	return arn.ARN{
+		Partition: p.ID(),
+		Service:   secretsmanager.ServiceName,
+		Region:    region,
+		AccountID: account,
+		Resource:  "secret:",
+	}.String(), nil
+}
+
+// predictARNs writes -env or -env-array output for secrets with ARNs made of
+// prefix and secret name, without the random suffix Secrets Manager adds.
+func predictARNs(w io.Writer, args runArgs, secrets []secret, prefix string) error {
+	var envArray []ecsSecret
+	for _, s := range secrets {
+		e := newEcsSecret(s, prefix+s.Name)
+		e.nameField, e.valueField = args.envNameField, args.envValueField
+		if args.envArray {
+			envArray = append(envArray, e)
+			continue
+		}
+		fmt.Fprintln(w, toJson(e))
+	}
+	if !args.envArray {
+		return nil
+	}
+	b, err := json.MarshalIndent(envArray, "", "\t")
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "%s\n", b)
+	return nil
+}
+
+// dryRunClient returns Secrets Manager client if both region and credentials
+// are configured.
+func dryRunClient(args runArgs) (secretsClient, error) {
+	sess, err := newSession(args)
+	if err != nil {
+		return nil, err
+	}
+	if aws.StringValue(sess.Config.Region) == "" {
+		return nil, aws.ErrMissingRegion
+	}
+	if _, err := sess.Config.Credentials.Get(); err != nil {
+		return nil, err
+	}
+	return newSecretsClient(sess), nil
+}
+
+// secretExists reports whether secret with a given name exists.
+func secretExists(ctx context.Context, svc secretsClient, name string) (bool, error) {
+	desc, err := describeSecret(ctx, svc, name)
+	return desc != nil, err
+}
+
+// describeSecret returns metadata of a secret with a given name, or nil if it
+// does not exist. Unlike GetSecretValue, it doesn't read the secret value.
+func describeSecret(ctx context.Context, svc secretsClient, name string) (*secretsmanager.DescribeSecretOutput, error) {
+	out, err := svc.DescribeSecretWithContext(ctx, &secretsmanager.DescribeSecretInput{
+		SecretId: &name,
+	})
+	if err == nil {
+		return out, nil
+	}
+	if isErrCode(err, secretsmanager.ErrCodeResourceNotFoundException) {
+		return nil, nil
+	}
+	return nil, fmt.Errorf("describe secret %q: %w", name, err)
+}
+
+// checkQuota returns an error if the number of existing secrets plus n new
+// ones exceeds max. Secrets that already exist are counted as new, so this
+// check may overestimate the resulting number of secrets.
+func checkQuota(ctx context.Context, svc secretsClient, n, max int) error {
+	var count int
+	err := svc.ListSecretsPagesWithContext(ctx, &secretsmanager.ListSecretsInput{MaxResults: aws.Int64(100)},
+		func(out *secretsmanager.ListSecretsOutput, _ bool) bool {
+			count += len(out.SecretList)
+			return true
+		})
+	if err != nil {
+		return fmt.Errorf("counting existing secrets: %w", err)
+	}
+	logDebug("found %d existing secrets", count)
+	if count+n > max {
+		return fmt.Errorf("%d existing secrets and %d new ones exceed the limit of %d secrets", count, n, max)
+	}
+	return nil
+}
+
+// confirm writes names of secrets to w, and asks to confirm their creation by
+// reading an answer from r.
+func confirm(r io.Reader, w io.Writer, secrets []secret) (bool, error) {
+	fmt.Fprintf(w, "%d secrets to create:\n", len(secrets))
+	for _, s := range secrets {
+		fmt.Fprintf(w, "\t%s\n", s.Name)
+	}
+	fmt.Fprint(w, "Proceed? [y/N] ")
+	answer, err := bufio.NewReader(r).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return false, err
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes", nil
+}
+
+// promptValues asks for the value of each secret on the terminal f, writing
+// prompts to w. Values are not echoed.
+func promptValues(f *os.File, w io.Writer, secrets []secret, maxValueSize int) error {
+	for i := range secrets {
+		s := &secrets[i]
+		fmt.Fprintf(w, "Value of %s: ", s.Name)
+		b, err := term.ReadPassword(int(f.Fd()))
+		fmt.Fprintln(w)
+		if err != nil {
+			return fmt.Errorf("reading value of secret %q: %w", s.Name, err)
+		}
+		s.Value = string(b)
+		if err := s.validate(maxValueSize); err != nil {
+			return fmt.Errorf("secret %q: %w", s.Name, err)
+		}
+	}
+	return nil
+}
+
+// isTerminal reports whether f is a terminal.
+func isTerminal(f *os.File) bool { return term.IsTerminal(int(f.Fd())) }
+
+// Exit codes
+const (
+	exitFailure = 1 // run failed without changing any secrets
+	exitPartial = 2 // run failed after changing some secrets
+)
+
+// partialError is returned by run when it fails after some secrets were
+// already created, updated, or deleted.
+type partialError struct {
+	err     error
+	changed int // number of secrets changed before the failure
+}
+
+func (e *partialError) Error() string { return e.err.Error() }
+func (e *partialError) Unwrap() error { return e.err }
+
+// summary holds counts of processed secrets by their status.
+type summary struct {
+	created, updated, replaced, skipped, failed int
+}
+
+// add accounts for a single processed secret.
+func (s *summary) add(o outcome, err error) {
+	switch {
+	case err != nil:
+		if !errors.Is(err, context.Canceled) {
+			s.failed++
+		}
+	case o.status == statusCreated:
+		s.created++
+	case o.status == statusUpdated:
+		s.updated++
+	case o.status == statusReplaced:
+		s.replaced++
+	case o.status == statusSkipped:
+		s.skipped++
+	}
+}
+
+func (s summary) String() string {
+	return fmt.Sprintf("created: %d, updated: %d, replaced: %d, skipped: %d, failed: %d",
+		s.created, s.updated, s.replaced, s.skipped, s.failed)
+}
+
+// createSecrets calls create for each secret using up to n concurrent workers,
+// then calls emit with each secret and its outcome, preserving the order of
+// secrets. Emit is only called from the calling goroutine, strictly in order,
+// however create calls finish; output formats rely on this. On the first
+// error it cancels the context passed to create calls in flight, stops
+// calling create, and returns that error once calls in flight return. Secrets
+// after the failed one that other workers stored meanwhile are still passed
+// to emit, so that their output isn't lost. If keepGoing is true, it instead
+// skips emit for failed secrets and returns all their errors joined once
+// every secret is processed.
+func createSecrets(ctx context.Context, n int, keepGoing bool, secrets []secret,
+	create func(context.Context, secret) (outcome, error),
+	emit func(secret, outcome)) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var once sync.Once
+	var firstErr error
+	fail := func(err error) {
+		once.Do(func() { firstErr = err; cancel() })
+	}
+	type result struct {
+		outcome
+		err error
+	}
+	results := make([]chan result, len(secrets))
+	for i := range results {
+		results[i] = make(chan result, 1)
+	}
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				o, err := create(ctx, secrets[i])
+				if err != nil && !keepGoing {
+					fail(err)
+				}
+				results[i] <- result{outcome: o, err: err}
+			}
+		}()
+	}
+	go func() {
+		defer close(jobs)
+		for i := range secrets {
+			select {
+			case jobs <- i:
+			case <-ctx.Done():
+				for ; i < len(secrets); i++ {
+					results[i] <- result{err: ctx.Err()}
+				}
+				return
+			}
+		}
+	}()
+	var errs []error
+	for i, ch := range results {
+		r := <-ch
+		if r.err != nil && keepGoing && ctx.Err() == nil {
+			errs = append(errs, r.err)
+			continue
+		}
+		if r.err != nil {
+			fail(r.err)
+			for j := i + 1; j < len(results); j++ {
+				if r := <-results[j]; r.err == nil {
+					emit(secrets[j], r.outcome)
+				}
+			}
+			return firstErr
+		}
+		emit(secrets[i], r.outcome)
+	}
+	return errors.Join(errs...)
+}
+
+// createBatches calls createSecrets for consecutive batches of
+// args.batchSize secrets, sleeping for args.batchPause between them, or for
+// all secrets at once if args.batchSize is 0. With args.continueOnError errors
+// of all batches are joined, otherwise it stops on the first failed batch.
+func createBatches(ctx context.Context, args runArgs, secrets []secret,
+	create func(context.Context, secret) (outcome, error),
+	emit func(secret, outcome)) error {
+	size := args.batchSize
+	if size == 0 {
+		size = len(secrets)
+	}
+	var errs []error
+	for start := 0; start < len(secrets); start += size {
+		if start != 0 && args.batchPause > 0 {
+			logDebug("processed %d secrets, pausing for %v", start, args.batchPause)
+			t := time.NewTimer(args.batchPause)
+			select {
+			case <-t.C:
+			case <-ctx.Done():
+				t.Stop()
+				return errors.Join(append(errs, ctx.Err())...)
+			}
+		}
+		end := start + size
+		if end > len(secrets) {
+			end = len(secrets)
+		}
+		if err := createSecrets(ctx, args.concurrency, args.continueOnError, secrets[start:end], create, emit); err != nil {
+			if !args.continueOnError || ctx.Err() != nil {
+				return errors.Join(append(errs, err)...)
+			}
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// outcome describes the result of processing a single secret.
+type outcome struct {
+	arn       string
+	versionID string
+	status    string // one of statusCreated, statusSkipped, statusUpdated, statusReplaced
+}
+
+const (
+	statusCreated  = "created"
+	statusSkipped  = "skipped"
+	statusUpdated  = "updated"
+	statusReplaced = "replaced"
+)
+
+// createOptions control how secrets are created.
+type createOptions struct {
+	exists   string // one of existsFail, existsSkip, existsUpdate, existsReplace, existsMergeJSON
+	replicas []*secretsmanager.ReplicaRegionType
+
+	// idempotent makes requests use client request tokens derived from
+	// secret names and values, see secret.requestToken
+	idempotent bool
+
+	// restore makes secrets scheduled for deletion restored and handled
+	// as existing ones, replaced if exists is existsFail
+	restore bool
+
+	// maxRetries is the max number of retries of throttled CreateSecret
+	// and PutSecretValue requests
+	maxRetries int
+}
+
+// createSecret creates a new secret. If secret already exists, it's handled
+// according to opts.exists, see existsMode. Unless opts.exists is existsFail,
+// existence is checked before trying to create a secret; with existsFail it's
+// a single CreateSecret call.
+func createSecret(ctx context.Context, svc secretsClient, s secret, opts createOptions) (outcome, error) {
+	opts.exists = existsMode(opts.exists, s)
+	if opts.exists != existsFail {
+		desc, err := describeSecret(ctx, svc, s.Name)
+		if err != nil {
+			return outcome{}, err
+		}
+		if desc != nil {
+			return handleExisting(ctx, svc, s, opts, desc)
+		}
+	}
+	in := &secretsmanager.CreateSecretInput{
+		Name:              &s.Name,
+		Tags:              s.Tags,
+		AddReplicaRegions: opts.replicas,
+	}
+	if s.Description != "" {
+		in.Description = &s.Description
+	}
+	if s.KMSKey != "" {
+		in.KmsKeyId = &s.KMSKey
+	}
+	if opts.idempotent {
+		in.ClientRequestToken = aws.String(s.requestToken())
+	}
+	if s.binary != nil {
+		in.SecretBinary = s.binary
+	} else {
+		in.SecretString = &s.Value
+	}
+	var out *secretsmanager.CreateSecretOutput
+	err := withRetries(ctx, opts.maxRetries, func() error {
+		var err error
+		out, err = svc.CreateSecretWithContext(ctx, in)
+		return err
+	})
+	if err == nil {
+		logReplication(s.Name, out.ReplicationStatus)
+		return outcome{arn: *out.ARN, versionID: aws.StringValue(out.VersionId), status: statusCreated}, nil
+	}
+	if isErrCode(err, secretsmanager.ErrCodeInvalidRequestException) {
+		// a secret scheduled for deletion has a deletion date, which
+		// tells it apart from other invalid requests
+		desc, derr := describeSecret(ctx, svc, s.Name)
+		if derr != nil {
+			return outcome{}, derr
+		}
+		if desc != nil && desc.DeletedDate != nil {
+			return handleExisting(ctx, svc, s, opts, desc)
+		}
+	}
+	if opts.exists == existsFail || !isErrCode(err, secretsmanager.ErrCodeResourceExistsException) {
+		return outcome{}, fmt.Errorf("create secret %q: %w", s.Name, err)
+	}
+	// secret was created after the check above
+	desc, err := describeSecret(ctx, svc, s.Name)
+	if err != nil {
+		return outcome{}, err
+	}
+	if desc == nil {
+		return outcome{}, fmt.Errorf("secret %q exists, but cannot be described", s.Name)
+	}
+	return handleExisting(ctx, svc, s, opts, desc)
+}
+
+// existsMode returns the -exists mode for secret s, given the global one. With
+// s.Overwrite set, existsFail and existsSkip become existsUpdate; other modes
+// already change existing secrets, at least as much as existsUpdate does, so
+// they are kept.
+func existsMode(exists string, s secret) string {
+	if s.Overwrite && (exists == existsFail || exists == existsSkip) {
+		return existsUpdate
+	}
+	return exists
+}
+
+// handleExisting handles secret that already exists according to
+// opts.exists. Desc is the existing secret metadata. Secrets scheduled for
+// deletion are restored first if opts.restore is set.
+func handleExisting(ctx context.Context, svc secretsClient, s secret, opts createOptions, desc *secretsmanager.DescribeSecretOutput) (outcome, error) {
+	if desc.DeletedDate != nil {
+		if !opts.restore {
+			return outcome{}, fmt.Errorf("secret %q is scheduled for deletion, use -restore to restore and store it", s.Name)
+		}
+		if err := restoreSecret(ctx, svc, s.Name); err != nil {
+			return outcome{}, err
+		}
+		if opts.exists == existsFail {
+			opts.exists = existsReplace
+		}
+	}
+	switch opts.exists {
+	case existsFail:
+		return outcome{}, fmt.Errorf("secret %q already exists", s.Name)
+	case existsSkip:
+		o := outcome{arn: *desc.ARN, status: statusSkipped}
+		for id, stages := range desc.VersionIdsToStages {
+			for _, stage := range stages {
+				if aws.StringValue(stage) == "AWSCURRENT" {
+					o.versionID = id
+				}
+			}
+		}
+		return o, nil
+	case existsUpdate:
+		o, err := putSecretValue(ctx, svc, s, opts)
+		if err != nil {
+			return outcome{}, err
+		}
+		if err := addReplicas(ctx, svc, s.Name, o.arn, opts.replicas); err != nil {
+			return outcome{}, err
+		}
+		o.status = statusUpdated
+		return o, nil
+	case existsReplace:
+		o, err := replaceSecret(ctx, svc, s, desc.Tags, opts)
+		if err != nil {
+			return outcome{}, err
+		}
+		if err := addReplicas(ctx, svc, s.Name, o.arn, opts.replicas); err != nil {
+			return outcome{}, err
+		}
+		o.status = statusReplaced
+		return o, nil
+	case existsMergeJSON:
+		v, err := mergeJSONValue(ctx, svc, s)
+		if err != nil {
+			return outcome{}, err
+		}
+		s.Value = v
+		o, err := putSecretValue(ctx, svc, s, opts)
+		if err != nil {
+			return outcome{}, err
+		}
+		if err := addReplicas(ctx, svc, s.Name, o.arn, opts.replicas); err != nil {
+			return outcome{}, err
+		}
+		o.status = statusUpdated
+		return o, nil
+	}
+	return outcome{}, fmt.Errorf("unsupported -exists value: %q", opts.exists)
+}
+
+// verifySecret reads the value of the secret version stored as o and returns
+// an error if it differs from the value of s.
+func verifySecret(ctx context.Context, svc secretsClient, o outcome, s secret) error {
+	in := &secretsmanager.GetSecretValueInput{SecretId: &o.arn}
+	if o.versionID != "" {
+		in.VersionId = &o.versionID
+	}
+	out, err := svc.GetSecretValueWithContext(ctx, in)
+	if err != nil {
+		return fmt.Errorf("verify secret %q: %w", s.Name, err)
+	}
+	var ok bool
+	if s.binary != nil {
+		ok = out.SecretString == nil && bytes.Equal(out.SecretBinary, s.binary)
+	} else {
+		ok = out.SecretString != nil && *out.SecretString == s.Value
+	}
+	if !ok {
+		return fmt.Errorf("verify secret %q: stored value differs from the input", s.Name)
+	}
+	return nil
+}
+
+// restoreSecret cancels scheduled deletion of the named secret.
+func restoreSecret(ctx context.Context, svc secretsClient, name string) error {
+	_, err := svc.RestoreSecretWithContext(ctx, &secretsmanager.RestoreSecretInput{SecretId: &name})
+	if err != nil {
+		return fmt.Errorf("restore secret %q: %w", name, err)
+	}
+	logSecret(levelNormal, name, "restored", nil)
+	return nil
+}
+
+// putResourcePolicy attaches resource-based policy to the secret identified
+// by arn. If blockPublic is true, policies granting wide access are rejected.
+func putResourcePolicy(ctx context.Context, svc secretsClient, arn, name, policy string, blockPublic bool) error {
+	_, err := svc.PutResourcePolicyWithContext(ctx, &secretsmanager.PutResourcePolicyInput{
+		SecretId:          &arn,
+		ResourcePolicy:    &policy,
+		BlockPublicPolicy: &blockPublic,
+	})
+	if err != nil {
+		return fmt.Errorf("secret %q stored, but attaching resource policy failed: %w", name, err)
+	}
+	return nil
+}
+
+// rotateSecret configures automatic rotation of the secret identified by arn
+// with the function and schedule from s. It doesn't rotate the secret right
+// away.
+func rotateSecret(ctx context.Context, svc secretsClient, arn string, s secret) error {
+	_, err := svc.RotateSecretWithContext(ctx, &secretsmanager.RotateSecretInput{
+		SecretId:          &arn,
+		RotationLambdaARN: &s.RotationLambdaARN,
+		RotationRules: &secretsmanager.RotationRulesType{
+			AutomaticallyAfterDays: aws.Int64(int64(s.RotationDays)),
+		},
+		RotateImmediately: aws.Bool(false),
+	})
+	if err != nil {
+		return fmt.Errorf("configure rotation of secret %q: %w", s.Name, err)
+	}
+	return nil
+}
+
+// addVersionStages adds staging labels from s, other than AWSCURRENT, which it
+// already has, to the first version of a newly created secret.
+func addVersionStages(ctx context.Context, svc secretsClient, o outcome, s secret) error {
+	for _, stage := range s.VersionStages {
+		if stage == "AWSCURRENT" {
+			continue
+		}
+		_, err := svc.UpdateSecretVersionStageWithContext(ctx, &secretsmanager.UpdateSecretVersionStageInput{
+			SecretId:        &o.arn,
+			VersionStage:    aws.String(stage),
+			MoveToVersionId: &o.versionID,
+		})
+		if err != nil {
+			return fmt.Errorf("secret %q created, but adding version stage %q failed: %w", s.Name, stage, err)
+		}
+	}
+	return nil
+}
+
+// addReplicas replicates an existing secret to regions it's not yet
+// replicated to.
+func addReplicas(ctx context.Context, svc secretsClient, name, arn string, replicas []*secretsmanager.ReplicaRegionType) error {
+	if len(replicas) == 0 {
+		return nil
+	}
+	desc, err := svc.DescribeSecretWithContext(ctx, &secretsmanager.DescribeSecretInput{SecretId: &arn})
+	if err != nil {
+		return fmt.Errorf("describe secret %q: %w", name, err)
+	}
+	have := make(map[string]struct{}, len(desc.ReplicationStatus))
+	for _, r := range desc.ReplicationStatus {
+		have[aws.StringValue(r.Region)] = struct{}{}
+	}
+	var missing []*secretsmanager.ReplicaRegionType
+	for _, r := range replicas {
+		if _, ok := have[*r.Region]; !ok {
+			missing = append(missing, r)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	out, err := svc.ReplicateSecretToRegionsWithContext(ctx, &secretsmanager.ReplicateSecretToRegionsInput{
+		SecretId:          &arn,
+		AddReplicaRegions: missing,
+	})
+	if err != nil {
+		return fmt.Errorf("replicate secret %q: %w", name, err)
+	}
+	logReplication(name, out.ReplicationStatus)
+	return nil
+}
+
+// logReplication logs replication status of a secret for each region.
+func logReplication(name string, status []*secretsmanager.ReplicationStatusType) {
+	for _, r := range status {
+		msg := aws.StringValue(r.Status)
+		if r.StatusMessage != nil {
+			msg += ": " + *r.StatusMessage
+		}
+		logInfo("secret %q replica in %s: %s", name, aws.StringValue(r.Region), msg)
+	}
+}
+
+// putSecretValue sets a new value of an existing secret and returns its ARN
+// and new version id.
+func putSecretValue(ctx context.Context, svc secretsClient, s secret, opts createOptions) (outcome, error) {
+	in := &secretsmanager.PutSecretValueInput{SecretId: &s.Name}
+	if len(s.VersionStages) != 0 {
+		in.VersionStages = aws.StringSlice(s.VersionStages)
+	}
+	if opts.idempotent {
+		in.ClientRequestToken = aws.String(s.requestToken())
+	}
+	if s.binary != nil {
+		in.SecretBinary = s.binary
+	} else {
+		in.SecretString = &s.Value
+	}
+	var out *secretsmanager.PutSecretValueOutput
+	err := withRetries(ctx, opts.maxRetries, func() error {
+		var err error
+		out, err = svc.PutSecretValueWithContext(ctx, in)
+		return err
+	})
+	if err != nil {
+		return outcome{}, fmt.Errorf("update secret %q value: %w", s.Name, err)
+	}
+	return outcome{arn: *out.ARN, versionID: aws.StringValue(out.VersionId)}, nil
+}
+
+// mergeJSONValue returns the current value of an existing secret, which must
+// be a JSON object, with keys from the JSON object value of s added, replacing
+// existing ones.
+func mergeJSONValue(ctx context.Context, svc secretsClient, s secret) (string, error) {
+	out, err := svc.GetSecretValueWithContext(ctx, &secretsmanager.GetSecretValueInput{SecretId: &s.Name})
+	if err != nil {
+		return "", fmt.Errorf("get secret %q value: %w", s.Name, err)
+	}
+	m, ok := jsonObjectValue(aws.StringValue(out.SecretString))
+	if out.SecretString == nil || !ok {
+		return "", fmt.Errorf("existing value of secret %q is not a JSON object", s.Name)
+	}
+	add, ok := jsonObjectValue(s.Value)
+	if !ok {
+		return "", fmt.Errorf("value of secret %q is not a JSON object", s.Name)
+	}
+	for k, v := range add {
+		m[k] = v
+	}
+	b, err := json.Marshal(m)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// jsonObjectValue parses s as a JSON object, reporting whether it is one.
+func jsonObjectValue(s string) (map[string]json.RawMessage, bool) {
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(s), &m); err != nil || m == nil {
+		return nil, false
+	}
+	return m, true
+}
+
+// replaceSecret updates value, description, and tags of an existing secret to
+// match s, and returns its ARN and new version id. Tags are the ones the
+// secret has, of which those not present in s are removed.
+func replaceSecret(ctx context.Context, svc secretsClient, s secret, tags []*secretsmanager.Tag, opts createOptions) (outcome, error) {
+	o, err := putSecretValue(ctx, svc, s, opts)
+	if err != nil {
+		return outcome{}, err
+	}
+	arn := o.arn
+	in := &secretsmanager.UpdateSecretInput{
+		SecretId:    &arn,
+		Description: &s.Description,
+	}
+	if s.KMSKey != "" {
+		in.KmsKeyId = &s.KMSKey
+	}
+	if _, err := svc.UpdateSecretWithContext(ctx, in); err != nil {
+		return outcome{}, fmt.Errorf("update secret %q: %w", s.Name, err)
+	}
+	want := make(map[string]string, len(s.Tags))
+	for _, t := range s.Tags {
+		want[*t.Key] = *t.Value
+	}
+	var stale []*string
+	have := make(map[string]string, len(tags))
+	for _, t := range tags {
+		have[*t.Key] = aws.StringValue(t.Value)
+		if _, ok := want[*t.Key]; !ok {
+			stale = append(stale, t.Key)
+		}
+	}
+	if len(stale) != 0 {
+		if _, err := svc.UntagResourceWithContext(ctx, &secretsmanager.UntagResourceInput{
+			SecretId: &arn,
+			TagKeys:  stale,
+		}); err != nil {
+			return outcome{}, fmt.Errorf("untag secret %q: %w", s.Name, err)
+		}
+	}
+	var changed []*secretsmanager.Tag
+	for _, t := range s.Tags {
+		if v, ok := have[*t.Key]; !ok || v != *t.Value {
+			changed = append(changed, t)
+		}
+	}
+	if len(changed) != 0 {
+		if _, err := svc.TagResourceWithContext(ctx, &secretsmanager.TagResourceInput{
+			SecretId: &arn,
+			Tags:     changed,
+		}); err != nil {
+			return outcome{}, fmt.Errorf("tag secret %q: %w", s.Name, err)
+		}
+	}
+	return o, nil
+}
+
+// rollback deletes secrets identified by ARNs in reverse order, without
+// recovery. Errors are logged, and it returns the number of secrets it failed
+// to delete.
+func rollback(ctx context.Context, svc secretsClient, arns []string) int {
+	var failed int
+	for i := len(arns) - 1; i >= 0; i-- {
+		_, err := svc.DeleteSecretWithContext(ctx, &secretsmanager.DeleteSecretInput{
+			SecretId:                   &arns[i],
+			ForceDeleteWithoutRecovery: aws.Bool(true),
+		})
+		if err != nil {
+			logSecret(levelQuiet, arns[i], "rollback failed", err)
+			failed++
+			continue
+		}
+		logSecret(levelNormal, arns[i], "rolled back", nil)
+	}
+	return failed
+}
+
+// retryDelay is the delay before the first retry of withRetries, it doubles
+// with each next one. Tests can lower it.
+var retryDelay = 200 * time.Millisecond
+
+// withRetries calls fn, retrying it with exponential backoff and jitter up to
+// maxRetries times while it returns throttling errors. Other errors are
+// returned right away. It stops retrying once ctx is canceled.
+func withRetries(ctx context.Context, maxRetries int, fn func() error) error {
+	const maxDelay = 20 * time.Second
+	delay := retryDelay
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= maxRetries || !isThrottling(err) {
+			return err
+		}
+		d := delay/2 + time.Duration(rand.Int63n(int64(delay)))
+		logDebug("retrying in %v: %v", d.Round(time.Millisecond), err)
+		timer := time.NewTimer(d)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+		if delay *= 2; delay > maxDelay {
+			delay = maxDelay
+		}
+	}
+}
+
+// isThrottling reports whether err is an AWS error caused by request
+// throttling.
+func isThrottling(err error) bool {
+	var aerr awserr.Error
+	if !errors.As(err, &aerr) {
+		return false
+	}
+	switch aerr.Code() {
+	case "ThrottlingException", "TooManyRequestsException", "Throttling", "RequestLimitExceeded":
+		return true
+	}
+	return false
+}
+
+// isErrCode reports whether err is an AWS error with a given code.
+func isErrCode(err error, code string) bool {
+	var aerr awserr.Error
+	return errors.As(err, &aerr) && aerr.Code() == code
+}
+
+type secret struct {
+	Name        string  `csv:"name" json:"name"`
+	SecretName  string  `csv:"secret_name" json:"secret_name"`
+	Value       string  `csv:"value" json:"value"`
+	ValueFile   string  `csv:"value_file" json:"value_file"`
+	ValueBase64 string  `csv:"value_base64" json:"value_base64"`
+	Description string  `csv:"description" json:"description"`
+	Tags        tagList `csv:"tags" json:"tags"`
+	EnvName     string  `csv:"env_name" json:"env_name"`
+	JSONKey     string  `csv:"key" json:"key"`
+	KMSKey      string  `csv:"kms_key" json:"kms_key"`
+
+	JSONKeyAlias string `csv:"json_key" json:"json_key"` // alias of JSONKey
+
+	VersionStages stageList `csv:"version_stages" json:"version_stages"`
+
+	Overwrite overwrite `csv:"overwrite" json:"overwrite"`
+
+	RotationLambdaARN string       `csv:"rotation_lambda_arn" json:"rotation_lambda_arn"`
+	RotationDays      rotationDays `csv:"rotation_days" json:"rotation_days"`
+
+	binary []byte // decoded ValueBase64
+	line   int    // line number in the input file
+	file   string // input file name, only set when reading multiple files
+	label  string // name column if SecretName overrides it
+	index  int    // position among secrets being created, set before creation
+
+	// columns of the CSV row other than values, by lowercase name, only
+	// set with readOptions.keepColumns
+	columns map[string]string
+}
+
+// prepare reads secret value from value_file, if it's set, and validates the
+// secret. Relative value_file path is resolved against dir.
+func (s *secret) prepare(dir string, opts readOptions) error {
+	if opts.trim {
+		s.Name = strings.TrimSpace(s.Name)
+		s.Value = strings.TrimSpace(s.Value)
+		s.Description = strings.TrimSpace(s.Description)
+		s.SecretName = strings.TrimSpace(s.SecretName)
+	}
+	if s.SecretName != "" {
+		s.label, s.Name, s.SecretName = s.Name, s.SecretName, ""
+	}
+	if s.JSONKeyAlias != "" {
+		if s.JSONKey != "" {
+			return errors.New("key and json_key cannot be set together")
+		}
+		s.JSONKey, s.JSONKeyAlias = s.JSONKeyAlias, ""
+	}
+	if opts.nameTransform != "" && opts.nameTransform != transformNone {
+		name := s.Name
+		s.Name = transformName(name, opts.nameTransform)
+		if err := s.validateName(); err != nil {
+			return fmt.Errorf("name %q with -name-transform=%s: %w", name, opts.nameTransform, err)
+		}
+		if s.Name != name {
+			logDebug("line %d: secret name %q becomes %q", s.line, name, s.Name)
+		}
+	}
+	if opts.namesOnly {
+		return s.validateName()
+	}
+	if s.EnvName != "" {
+		name, err := fixEnvName(s.EnvName, opts.strictEnv)
+		if err != nil {
+			return err
+		}
+		if name != s.EnvName {
+			logDebug("line %d: env_name %q becomes %q", s.line, s.EnvName, name)
+		}
+		s.EnvName = name
+	}
+	if s.KMSKey == "" {
+		s.KMSKey = opts.kmsKey
+	}
+	if countTrue(s.Value != "", s.ValueFile != "", s.ValueBase64 != "") > 1 {
+		return errors.New("only one of value, value_file, and value_base64 can be set")
+	}
+	if strings.Contains(s.JSONKey, ":") {
+		return errors.New("key cannot contain colons")
+	}
+	if (s.RotationLambdaARN != "") != (s.RotationDays != 0) {
+		return errors.New("rotation_lambda_arn and rotation_days must be set together")
+	}
+	if s.RotationDays < 0 || s.RotationDays > maxRotationDays {
+		return fmt.Errorf("rotation_days must be from 1 to %d", maxRotationDays)
+	}
+	if len(s.VersionStages) > maxStages {
+		return fmt.Errorf("version_stages can have at most %d labels", maxStages)
+	}
+	for _, stage := range s.VersionStages {
+		if len(stage) > maxStageLength {
+			return fmt.Errorf("version stage %q is longer than %d characters", stage, maxStageLength)
+		}
+	}
+	if opts.promptValues {
+		if s.Value != "" || s.ValueFile != "" || s.ValueBase64 != "" {
+			return errors.New("values cannot be set in the input with -interactive-values")
+		}
+		// value is validated once it's entered
+		return s.validateName()
+	}
+	if opts.expand && !opts.jsonSecret {
+		v, err := expandEnv(s.Value)
+		if err != nil {
+			return err
+		}
+		s.Value = v
+	}
+	if s.ValueBase64 != "" {
+		b, err := base64.StdEncoding.DecodeString(s.ValueBase64)
+		if err != nil {
+			return fmt.Errorf("decoding value_base64: %w", err)
+		}
+		s.binary = b
+	}
+	if s.ValueFile != "" {
+		name := s.ValueFile
+		if !filepath.IsAbs(name) {
+			name = filepath.Join(dir, name)
+		}
+		b, err := ioutil.ReadFile(name)
+		if err != nil {
+			return fmt.Errorf("reading value_file: %w", err)
+		}
+		s.Value = string(b)
+	}
+	if opts.normNewlines {
+		s.Value = normalizeNewlines(s.Value)
+	}
+	return s.validate(opts.maxValueSize)
+}
+
+// emptyRow reports whether cells of a CSV row at given indexes are all empty,
+// checking them with surrounding spaces trimmed if trim is true.
+func emptyRow(row []string, cols []int, trim bool) bool {
+	for _, i := range cols {
+		v := row[i]
+		if trim {
+			v = strings.TrimSpace(v)
+		}
+		if v != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// String implements fmt.Stringer. It never includes secret value, so that
+// a secret accidentally formatted into an error or log message doesn't
+// leak it.
+func (s secret) String() string {
+	return fmt.Sprintf("secret %q (value redacted)", s.Name)
+}
+
+// GoString implements fmt.GoStringer the same way as String, so %#v doesn't
+// expose secret value either.
+func (s secret) GoString() string { return s.String() }
+
+// normalizeNewlines converts "\r\n" and lone "\r" line endings in s to "\n".
+func normalizeNewlines(s string) string {
+	if !strings.Contains(s, "\r") {
+		return s
+	}
+	return strings.ReplaceAll(strings.ReplaceAll(s, "\r\n", "\n"), "\r", "\n")
+}
+
+// expandEnv works like os.ExpandEnv, but returns an error on the first
+// undefined variable instead of replacing it with an empty string. $$ is
+// replaced with a literal $.
+func expandEnv(s string) (string, error) {
+	var missing string
+	out := os.Expand(s, func(name string) string {
+		if name == "$" {
+			return "$"
+		}
+		v, ok := os.LookupEnv(name)
+		if !ok && missing == "" {
+			missing = name
+		}
+		return v
+	})
+	if missing != "" {
+		return "", fmt.Errorf("undefined environment variable %q", missing)
+	}
+	return out, nil
+}
+
+// position returns secret location in the input for error messages: either
+// "line N", or "file:N" when reading multiple files.
+func (s *secret) position() string {
+	if s.file != "" {
+		return s.file + ":" + strconv.Itoa(s.line)
+	}
+	return "line " + strconv.Itoa(s.line)
+}
+
+// requestToken returns a token derived from the secret name and value, which
+// can be used as a ClientRequestToken to make repeated requests with the same
+// input idempotent. Secrets Manager requires tokens of 32 to 64 characters, so
+// it's a hash formatted as a 36 characters long UUID.
+func (s *secret) requestToken() string {
+	h := sha256.New()
+	io.WriteString(h, s.Name)
+	if s.binary != nil {
+		h.Write([]byte{1})
+		h.Write(s.binary)
+	} else {
+		h.Write([]byte{0})
+		io.WriteString(h, s.Value)
+	}
+	b := h.Sum(nil)
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// Secrets Manager limits
+const (
+	maxNameLength   = 512
+	maxValueLength  = 65536
+	maxRotationDays = 1000
+	maxStages       = 20
+	maxStageLength  = 256
+)
+
+// validate checks secret name and value. Values larger than maxValueSize
+// bytes are rejected, 0 means the Secrets Manager limit.
+func (s *secret) validate(maxValueSize int) error {
+	if maxValueSize <= 0 {
+		maxValueSize = maxValueLength
+	}
+	if err := s.validateName(); err != nil {
+		return err
+	}
+	if s.binary != nil {
+		if len(s.binary) == 0 {
+			return errors.New("empty secret value")
+		}
+		if len(s.binary) > maxValueSize {
+			return fmt.Errorf("binary value exceeds %d bytes (got %d)", maxValueSize, len(s.binary))
+		}
+		return nil
+	}
+	if s.Value == "" {
+		return errors.New("empty secret value")
+	}
+	if len(s.Value) > maxValueSize {
+		return fmt.Errorf("value exceeds %d bytes (got %d)", maxValueSize, len(s.Value))
+	}
+	return nil
+}
+
+func (s *secret) validateName() error {
+	if s.Name == "" {
+		return errors.New("empty secret name")
+	}
+	if len(s.Name) > maxNameLength {
+		return fmt.Errorf("secret name is longer than %d characters", maxNameLength)
+	}
+	for _, r := range s.Name {
+		if !validNameRune(r) {
+			return fmt.Errorf("secret name %q has invalid character %q", s.Name, r)
+		}
+	}
+	return nil
+}
+
+// transformName returns name transformed according to transform, which is
+// one of transformNone, transformLower, transformUpper, transformSlug.
+func transformName(name, transform string) string {
+	switch transform {
+	case transformLower:
+		return strings.ToLower(name)
+	case transformUpper:
+		return strings.ToUpper(name)
+	case transformSlug:
+		return strings.Map(func(r rune) rune {
+			r = unicode.ToLower(r)
+			switch {
+			case r == ' ':
+				return '-'
+			case !validNameRune(r):
+				return -1
+			}
+			return r
+		}, name)
+	}
+	return name
+}
+
+// validNameRune reports whether r is allowed in a secret name.
+func validNameRune(r rune) bool {
+	switch {
+	case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		return true
+	}
+	return strings.ContainsRune("/_+=.@-", r)
+}
+
+// tagList is a list of secret tags. It implements csvstruct.Value interface,
+// parsing a semicolon-separated list of key=value pairs.
+type tagList []*secretsmanager.Tag
+
+// UnmarshalJSON implements json.Unmarshaler, decoding tags from a JSON object
+// with string values.
+func (t *tagList) UnmarshalJSON(b []byte) error {
+	var m map[string]string
+	if err := json.Unmarshal(b, &m); err != nil {
+		return err
+	}
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		*t = append(*t, &secretsmanager.Tag{Key: aws.String(k), Value: aws.String(m[k])})
+	}
+	return nil
+}
+
+func (t *tagList) Set(s string) error {
+	if s == "" {
+		return nil
+	}
+	for _, kv := range strings.Split(s, ";") {
+		kv = strings.TrimSpace(kv)
+		i := strings.IndexByte(kv, '=')
+		if i < 1 {
+			return fmt.Errorf("malformed tag %q, want key=value", kv)
+		}
+		*t = append(*t, &secretsmanager.Tag{
+			Key:   aws.String(kv[:i]),
+			Value: aws.String(kv[i+1:]),
+		})
+	}
+	return nil
+}
+
+// rotationDays is a number of days between automatic rotations of a secret,
+// 0 if rotation is not configured. It implements csvstruct.Value, so that
+// empty cells are allowed.
+type rotationDays int64
+
+func (d *rotationDays) Set(s string) error {
+	if s == "" {
+		*d = 0
+		return nil
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 1 {
+		return fmt.Errorf("rotation_days must be a positive integer, got %q", s)
+	}
+	*d = rotationDays(n)
+	return nil
+}
+
+// overwrite is a per-secret override of the -exists flag. It implements
+// csvstruct.Value, accepting true, false, 1, 0, yes, no in any case, and an
+// empty cell as false.
+type overwrite bool
+
+func (o *overwrite) Set(s string) error {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "true", "1", "yes":
+		*o = true
+	case "false", "0", "no", "":
+		*o = false
+	default:
+		return fmt.Errorf("overwrite must be true, false, 1, 0, yes, or no, got %q", s)
+	}
+	return nil
+}
+
+// UnmarshalJSON implements json.Unmarshaler, accepting a JSON boolean or
+// a string that Set accepts.
+func (o *overwrite) UnmarshalJSON(b []byte) error {
+	var v bool
+	if err := json.Unmarshal(b, &v); err == nil {
+		*o = overwrite(v)
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return errors.New("overwrite must be a boolean or a string")
+	}
+	return o.Set(s)
+}
+
+// stageList is a list of version staging labels. It implements
+// csvstruct.Value interface, parsing a semicolon-separated list.
+type stageList []string
+
+// UnmarshalJSON implements json.Unmarshaler, decoding labels from a JSON
+// array of strings.
+func (l *stageList) UnmarshalJSON(b []byte) error {
+	var stages []string
+	if err := json.Unmarshal(b, &stages); err != nil {
+		return err
+	}
+	for _, stage := range stages {
+		if stage == "" {
+			return errors.New("empty version stage")
+		}
+	}
+	*l = stages
+	return nil
+}
+
+func (l *stageList) Set(s string) error {
+	if s == "" {
+		return nil
+	}
+	for _, stage := range strings.Split(s, ";") {
+		stage = strings.TrimSpace(stage)
+		if stage == "" {
+			return fmt.Errorf("empty version stage in %q", s)
+		}
+		*l = append(*l, stage)
+	}
+	return nil
+}
+
+// tagFlag is a flag.Value accumulating tags from multiple key=value flags.
+type tagFlag []*secretsmanager.Tag
+
+func (t *tagFlag) String() string {
+	var pairs []string
+	for _, tag := range *t {
+		pairs = append(pairs, *tag.Key+"="+*tag.Value)
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (t *tagFlag) Set(s string) error {
+	i := strings.IndexByte(s, '=')
+	if i < 1 || strings.Count(s, "=") != 1 {
+		return errors.New("tag must be in key=value form")
+	}
+	*t = append(*t, &secretsmanager.Tag{
+		Key:   aws.String(s[:i]),
+		Value: aws.String(s[i+1:]),
+	})
+	return nil
+}
+
+// replicaFlag is a flag.Value accumulating replica regions from multiple
+// REGION[:kms-key] flags.
+type replicaFlag []*secretsmanager.ReplicaRegionType
+
+func (f *replicaFlag) String() string {
+	var out []string
+	for _, r := range *f {
+		s := *r.Region
+		if r.KmsKeyId != nil {
+			s += ":" + *r.KmsKeyId
+		}
+		out = append(out, s)
+	}
+	return strings.Join(out, ",")
+}
+
+func (f *replicaFlag) Set(s string) error {
+	region, key := s, ""
+	if i := strings.IndexByte(s, ':'); i != -1 {
+		region, key = s[:i], s[i+1:]
+		if key == "" {
+			return errors.New("empty kms key")
+		}
+	}
+	if !regionRe.MatchString(region) {
+		return fmt.Errorf("invalid region %q", region)
+	}
+	for _, r := range *f {
+		if *r.Region == region {
+			return fmt.Errorf("duplicate region %q", region)
+		}
+	}
+	r := &secretsmanager.ReplicaRegionType{Region: aws.String(region)}
+	if key != "" {
+		r.KmsKeyId = aws.String(key)
+	}
+	*f = append(*f, r)
+	return nil
+}
+
+// globFlag is a flag.Value accumulating path.Match patterns from multiple
+// flags.
+type globFlag []string
+
+func (f *globFlag) String() string { return strings.Join(*f, ",") }
+
+func (f *globFlag) Set(s string) error {
+	if _, err := path.Match(s, ""); err != nil {
+		return fmt.Errorf("invalid pattern %q: %w", s, err)
+	}
+	*f = append(*f, s)
+	return nil
+}
+
+// regionRe matches AWS region names like us-east-1 or us-gov-west-1.
+var regionRe = regexp.MustCompile(`^[a-z]{2}(-[a-z]+)+-\d+$`)
+
+// mergeTags returns common tags combined with secret-specific ones, the latter
+// take precedence on conflicting keys.
+func mergeTags(common, specific []*secretsmanager.Tag) []*secretsmanager.Tag {
+	if len(common) == 0 {
+		return specific
+	}
+	seen := make(map[string]struct{}, len(specific))
+	for _, t := range specific {
+		seen[*t.Key] = struct{}{}
+	}
+	out := make([]*secretsmanager.Tag, 0, len(common)+len(specific))
+	for _, t := range common {
+		if _, ok := seen[*t.Key]; !ok {
+			out = append(out, t)
+		}
+	}
+	return append(out, specific...)
+}
+
+// readOptions control input parsing.
+type readOptions struct {
+	format  string // one of formatCSV, formatJSON, formatEnv
+	comma   rune   // CSV field delimiter
+	comment rune   // CSV comment character, 0 disables comments
+	trim    bool   // trim spaces around names, values, and descriptions
+
+	lazyQuotes bool // tolerate malformed CSV quoting, see csv.Reader.LazyQuotes
+	skipEmpty  bool // skip CSV rows with empty name and value
+
+	// descColumns are lowercase names of columns with descriptions, set
+	// with -description-column, the first one in the header is used
+	descColumns []string
+
+	nameTransform string // one of transformNone, transformLower, transformUpper, transformSlug
+
+	strictEnv bool // reject env_name values that need fixing up
+
+	keepColumns bool // set secret.columns for -description-template
+
+	// jsonSecret makes secret value a JSON object built from all CSV
+	// columns except name and metadata ones like description or tags
+	jsonSecret bool
+	jsonKeys   []string // only use these columns for JSON secret value
+
+	// expand replaces ${VAR} and $VAR in values with environment
+	// variables, undefined variables are reported as errors
+	expand bool
+
+	normNewlines bool // convert \r\n and \r in values to \n
+
+	gzip bool // input is gzip-compressed
+
+	maxValueSize int // max secret value size in bytes, 0 for the default
+
+	kmsKey string // KMS key for secrets without kms_key set
+
+	// namesOnly only requires and validates secret names, values are
+	// ignored
+	namesOnly bool
+
+	// promptValues rejects values in the input, as they're read with
+	// promptValues once the input is validated
+	promptValues bool
+}
+
+// Supported input formats
+const (
+	formatCSV  = "csv"
+	formatJSON = "json"
+	formatEnv  = "env"
+)
+
+// inputFormat returns format to use for a named input: explicitly set format,
+// or one derived from the name extension, ignoring the .gz one.
+func inputFormat(name, format string) (string, error) {
+	switch format {
+	case formatCSV, formatJSON, formatEnv:
+		return format, nil
+	case "":
+	default:
+		return "", fmt.Errorf("unsupported input format %q", format)
+	}
+	if isGzipName(name) {
+		name = name[:len(name)-len(".gz")]
+	}
+	if strings.EqualFold(path.Ext(name), ".json") {
+		return formatJSON, nil
+	}
+	if strings.EqualFold(path.Ext(name), ".env") {
+		return formatEnv, nil
+	}
+	return formatCSV, nil
+}
+
+// isGzipName reports whether the named input is expected to be
+// gzip-compressed.
+func isGzipName(name string) bool { return strings.EqualFold(path.Ext(name), ".gz") }
+
+// parseDelimiter validates that s can be used as a CSV field delimiter, and
+// returns it as a rune. As a special case, `\t` is treated as a tab.
+func parseDelimiter(s string) (rune, error) {
+	if s == `\t` {
+		return '\t', nil
+	}
+	r, size := utf8.DecodeRuneInString(s)
+	if size == 0 || size != len(s) {
+		return 0, fmt.Errorf("delimiter must be a single character, got %q", s)
+	}
+	switch r {
+	case '"', '\r', '\n', utf8.RuneError:
+		return 0, fmt.Errorf("invalid delimiter %q", s)
+	}
+	return r, nil
+}
+
+// parseComment validates that s can be used as a CSV comment character along
+// with the comma delimiter, and returns it as a rune. Empty s disables
+// comments and is returned as 0.
+func parseComment(s string, comma rune) (rune, error) {
+	if s == "" {
+		return 0, nil
+	}
+	r, size := utf8.DecodeRuneInString(s)
+	if size != len(s) {
+		return 0, fmt.Errorf("comment must be a single character, got %q", s)
+	}
+	switch r {
+	case '"', '\r', '\n', comma, utf8.RuneError:
+		return 0, fmt.Errorf("invalid comment character %q", s)
+	}
+	return r, nil
+}
+
+// readSecrets reads secrets from a named CSV file, or from stdin if name is
+// "-".
+func readSecrets(name string, opts readOptions) ([]secret, error) {
+	if name == "-" {
+		return parseSecrets(os.Stdin, "", opts)
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parseSecrets(f, filepath.Dir(name), opts)
+}
+
+// parseS3URL splits s3://bucket/key URL into bucket and key.
+func parseS3URL(s string) (bucket, key string, err error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return "", "", err
+	}
+	if u.Scheme != "s3" || u.Host == "" || len(u.Path) < 2 {
+		return "", "", fmt.Errorf("invalid S3 URL %q, want s3://bucket/key", s)
+	}
+	return u.Host, u.Path[1:], nil
+}
+
+// readS3Secrets reads secrets from a CSV file stored in S3.
+func readS3Secrets(ctx context.Context, sess *session.Session, bucket, key string, opts readOptions) ([]secret, error) {
+	out, err := s3.New(sess).GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: &bucket,
+		Key:    &key,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("get s3 object (bucket %q, key %q): %w", bucket, key, err)
+	}
+	defer out.Body.Close()
+	return parseSecrets(out.Body, "", opts)
+}
+
+const utf8BOM = "\ufeff"
+
+// parseSecrets reads secrets in a format set by opts. Relative paths from the
+// value_file column are resolved against dir.
+func parseSecrets(rd io.Reader, dir string, opts readOptions) ([]secret, error) {
+	if opts.gzip {
+		zr, err := gzip.NewReader(rd)
+		if err != nil {
+			return nil, fmt.Errorf("input is not a valid gzip file: %w", err)
+		}
+		defer zr.Close()
+		rd = zr
+	}
+	br := bufio.NewReader(rd)
+	// files saved by some Windows tools start with a UTF-8 byte order mark
+	if b, err := br.Peek(len(utf8BOM)); err == nil && string(b) == utf8BOM {
+		br.Discard(len(utf8BOM))
+	}
+	rd = br
+	switch opts.format {
+	case formatJSON:
+		return parseJSON(rd, dir, opts)
+	case formatEnv:
+		return parseEnv(rd, dir, opts)
+	}
+	return parseCSV(rd, dir, opts)
+}
+
+// parseJSON reads secrets from a JSON array of objects with the same fields
+// as CSV columns.
+func parseJSON(rd io.Reader, dir string, opts readOptions) ([]secret, error) {
+	data, err := ioutil.ReadAll(rd)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if t, err := dec.Token(); err != nil || t != json.Delim('[') {
+		return nil, errors.New("json input must be an array of objects")
+	}
+	var out []secret
+	for dec.More() {
+		var s secret
+		s.line = lineAt(data, dec.InputOffset())
+		if err := dec.Decode(&s); err != nil {
+			// syntax error messages quote offending input, which may
+			// be part of a secret value
+			var serr *json.SyntaxError
+			if errors.As(err, &serr) {
+				return nil, fmt.Errorf("line %d: invalid JSON syntax", lineAt(data, serr.Offset))
+			}
+			return nil, fmt.Errorf("line %d: %w", s.line, err)
+		}
+		if err := s.prepare(dir, opts); err != nil {
+			return nil, fmt.Errorf("line %d: %w", s.line, err)
+		}
+		out = append(out, s)
+	}
+	if _, err := dec.Token(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// jsonObject returns JSON object with given keys and string values, keeping
+// keys order.
+func jsonObject(keys, values []string) string {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i := range keys {
+		if i != 0 {
+			buf.WriteByte(',')
+		}
+		k, _ := json.Marshal(keys[i])
+		v, _ := json.Marshal(values[i])
+		buf.Write(k)
+		buf.WriteByte(':')
+		buf.Write(v)
+	}
+	buf.WriteByte('}')
+	return buf.String()
 }
 
-func (s *secret) validate() error {
-	if s.Name == "" {
-		return errors.New("empty secret name")
-	}
-	if s.Value == "" {
-		return errors.New("empty secret value")
+// lineAt returns line number of the first non-whitespace character starting
+// from offset in data, skipping commas.
+func lineAt(data []byte, offset int64) int {
+	for offset < int64(len(data)) && strings.IndexByte(" \t\r\n,", data[offset]) != -1 {
+		offset++
 	}
-	return nil
+	return 1 + bytes.Count(data[:offset], []byte{'\n'})
 }
 
-func readSecrets(name string) ([]secret, error) {
-	f, err := os.Open(name)
-	if err != nil {
-		return nil, err
+// parseCSV reads secrets from CSV.
+func parseCSV(rd io.Reader, dir string, opts readOptions) ([]secret, error) {
+	if !opts.lazyQuotes {
+		q := &quotedCRLFReader{r: bufio.NewReader(rd)}
+		if opts.comment != 0 {
+			q.comment = []byte(string(opts.comment))
+		}
+		rd = q
 	}
-	defer f.Close()
-	r := csv.NewReader(f)
+	r := csv.NewReader(rd)
+	if opts.comma != 0 {
+		r.Comma = opts.comma
+	}
+	r.Comment = opts.comment
+	r.LazyQuotes = opts.lazyQuotes
 	r.ReuseRecord = true
-	header, err := r.Read()
+	record, err := r.Read()
 	if err != nil {
 		return nil, fmt.Errorf("csv header read: %w", err)
 	}
+	// column names are matched ignoring case and surrounding spaces; keep
+	// original ones as JSON keys
+	header := make([]string, len(record))
+	orig := make([]string, len(record))
+	for i, col := range record {
+		orig[i] = strings.TrimSpace(col)
+		header[i] = strings.ToLower(orig[i])
+	}
+	descCol := descriptionColumn(header, opts.descColumns)
+	if err := checkHeader(header, !opts.jsonSecret && !opts.namesOnly && !opts.promptValues); err != nil {
+		return nil, err
+	}
+	var jsonCols []int // indexes of columns making JSON secret value
+	var jsonKeys []string
+	switch {
+	case len(opts.jsonKeys) != 0:
+		var missing []string
+		for _, key := range opts.jsonKeys {
+			i := columnIndex(header, strings.ToLower(key))
+			if i < 0 {
+				missing = append(missing, strconv.Quote(key))
+				continue
+			}
+			jsonCols = append(jsonCols, i)
+			jsonKeys = append(jsonKeys, orig[i])
+		}
+		if len(missing) != 0 {
+			return nil, fmt.Errorf("csv header is missing columns %s listed in -json-keys", strings.Join(missing, ", "))
+		}
+	case opts.jsonSecret:
+		for i, col := range header {
+			if col == "name" || metadataColumns[col] || i == descCol {
+				continue
+			}
+			jsonCols = append(jsonCols, i)
+			jsonKeys = append(jsonKeys, orig[i])
+		}
+		if len(jsonCols) == 0 {
+			return nil, errors.New("no columns to build JSON secret value from")
+		}
+	}
+	hasKMSKey := columnIndex(header, "kms_key") >= 0
 	scan, err := csvstruct.NewScanner(header, &secret{})
 	if err != nil {
 		return nil, err
 	}
 	var out []secret
+	var skipped int   // empty rows with opts.skipEmpty
+	var keyCols []int // name and value columns checked with opts.skipEmpty
+	for _, col := range []string{"name", "secret_name", "value", "value_file", "value_base64"} {
+		if i := columnIndex(header, col); i >= 0 {
+			keyCols = append(keyCols, i)
+		}
+	}
+	keyCols = append(keyCols, jsonCols...)
 	for {
 		row, err := r.Read()
 		if err != nil {
 			if err == io.EOF {
+				if skipped != 0 {
+					logDebug("skipped %d empty rows", skipped)
+				}
 				return out, nil
 			}
 			return nil, err
 		}
+		if opts.skipEmpty && emptyRow(row, keyCols, opts.trim) {
+			skipped++
+			continue
+		}
 		var s secret
+		s.line, _ = r.FieldPos(0)
 		if err := scan(row, &s); err != nil {
-			return nil, err
+			return nil, fmt.Errorf("line %d: %w", s.line, err)
 		}
-		if err := s.validate(); err != nil {
-			return nil, err
+		if descCol >= 0 {
+			s.Description = row[descCol]
+		}
+		if opts.keepColumns {
+			s.columns = make(map[string]string, len(header))
+			for i, col := range header {
+				if col != "value" && col != "value_base64" {
+					s.columns[col] = row[i]
+				}
+			}
+		}
+		if hasKMSKey && s.KMSKey == "" && opts.kmsKey == "" {
+			return nil, fmt.Errorf("line %d: empty kms_key", s.line)
+		}
+		if opts.jsonSecret {
+			// columns like value or value_file are just JSON keys here
+			values := make([]string, len(jsonCols))
+			for i, idx := range jsonCols {
+				values[i] = row[idx]
+				if opts.normNewlines {
+					values[i] = normalizeNewlines(values[i])
+				}
+				if opts.expand {
+					if values[i], err = expandEnv(values[i]); err != nil {
+						return nil, fmt.Errorf("line %d: column %q: %w", s.line, jsonKeys[i], err)
+					}
+				}
+			}
+			s.Value, s.ValueFile, s.ValueBase64 = jsonObject(jsonKeys, values), "", ""
+		}
+		if err := s.prepare(dir, opts); err != nil {
+			return nil, fmt.Errorf("line %d: %w", s.line, err)
 		}
 		out = append(out, s)
 	}
 }
 
+// metadataColumns describe secrets rather than hold their values, so they
+// are not included into -json-secret values.
+var metadataColumns = map[string]bool{
+	"description":         true,
+	"tags":                true,
+	"env_name":            true,
+	"secret_name":         true,
+	"key":                 true,
+	"json_key":            true,
+	"kms_key":             true,
+	"version_stages":      true,
+	"overwrite":           true,
+	"rotation_lambda_arn": true,
+	"rotation_days":       true,
+}
+
+// quotedCRLFReader passes CSV input through, doubling carriage returns of
+// "\r\n" line breaks inside quoted fields, which encoding/csv otherwise reads
+// as "\n", so that such values are read byte for byte. Line breaks ending
+// records are passed as is. It relies on well-formed quoting, so it's not used
+// with LazyQuotes.
+type quotedCRLFReader struct {
+	r        *bufio.Reader
+	comment  []byte // comment character, nil if comments are disabled
+	inQuotes bool   // whether the input read so far ends inside a quoted field
+	buf      []byte // processed input not read yet
+	err      error
+}
+
+func (q *quotedCRLFReader) Read(p []byte) (int, error) {
+	for len(q.buf) == 0 {
+		if q.err != nil {
+			return 0, q.err
+		}
+		line, err := q.r.ReadBytes('\n')
+		q.err = err
+		if !q.inQuotes && q.comment != nil && bytes.HasPrefix(line, q.comment) {
+			q.buf = line
+			continue
+		}
+		// escaped quotes are doubled, so they don't change the state
+		if bytes.Count(line, []byte{'"'})%2 == 1 {
+			q.inQuotes = !q.inQuotes
+		}
+		if q.inQuotes && bytes.HasSuffix(line, []byte("\r\n")) {
+			line = append(line[:len(line)-1], '\r', '\n')
+		}
+		q.buf = line
+	}
+	n := copy(p, q.buf)
+	q.buf = q.buf[n:]
+	return n, nil
+}
+
+// descriptionColumn returns the index of the header column with
+// descriptions, which is the first one of cols present in the header, or -1
+// if there's none, in which case descriptions are read from the "description"
+// column, if any.
+func descriptionColumn(header []string, cols []string) int {
+	for _, col := range cols {
+		if i := columnIndex(header, col); i >= 0 {
+			return i
+		}
+	}
+	return -1
+}
+
+// columnIndex returns index of col in header, or -1 if it's not present.
+func columnIndex(header []string, col string) int {
+	for i, h := range header {
+		if h == col {
+			return i
+		}
+	}
+	return -1
+}
+
+// checkHeader verifies that CSV header has the name column and, if
+// needValue is true, at least one of the value columns. Error for a missing
+// column suggests the closest existing one, to make typos like "names"
+// obvious.
+func checkHeader(header []string, needValue bool) error {
+	has := func(col string) bool { return columnIndex(header, col) >= 0 }
+	var missing []string
+	if !has("name") {
+		missing = append(missing, "name")
+	}
+	if needValue && !has("value") && !has("value_file") && !has("value_base64") {
+		missing = append(missing, "value")
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	var msgs []string
+	for _, col := range missing {
+		msg := strconv.Quote(col)
+		if h := closestColumn(header, col); h != "" {
+			msg += fmt.Sprintf(" (did you mean %q?)", h)
+		}
+		msgs = append(msgs, msg)
+	}
+	quoted := make([]string, len(header))
+	for i, h := range header {
+		quoted[i] = strconv.Quote(h)
+	}
+	return fmt.Errorf("csv header is missing required columns %s, found columns: %s",
+		strings.Join(msgs, ", "), strings.Join(quoted, ", "))
+}
+
+// closestColumn returns a header column that is a near miss for col, within
+// a small edit distance. It returns an empty string if there's no such
+// column.
+func closestColumn(header []string, col string) string {
+	best, bestDist := "", 3 // only consider distances up to 2
+	for _, h := range header {
+		d := editDistance(h, col)
+		if d < bestDist {
+			best, bestDist = h, d
+		}
+	}
+	return best
+}
+
+// editDistance returns Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min3(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
+
+// Default JSON keys of ecsSecret fields, as used by ECS
+const (
+	defaultEnvNameField  = "name"
+	defaultEnvValueField = "valueFrom"
+)
+
+// ecsSecret is an element of the "secrets" array of an ECS task definition.
+type ecsSecret struct {
+	Name  string
+	Value string
+
+	VersionID string // not used by ECS, "versionId" key is omitted if empty
+
+	nameField, valueField string // JSON keys of Name and Value
+}
+
+// MarshalJSON implements json.Marshaler, encoding Name and Value with
+// nameField and valueField keys.
+func (e ecsSecret) MarshalJSON() ([]byte, error) {
+	keys := []string{e.nameField, e.valueField}
+	values := []string{e.Name, e.Value}
+	if e.VersionID != "" {
+		keys = append(keys, "versionId")
+		values = append(values, e.VersionID)
+	}
+	return []byte(jsonObject(keys, values)), nil
+}
+
+// newEcsSecret returns ecsSecret for a secret with a given ARN. See
+// secret.varName on how variable name is chosen. If the secret has a JSON
+// key set, the reference points to this key of a JSON secret value.
+func newEcsSecret(s secret, arn string) ecsSecret {
+	if s.JSONKey != "" {
+		arn += ":" + s.JSONKey + "::"
+	}
+	return ecsSecret{
+		Name:       s.varName(),
+		Value:      arn,
+		nameField:  defaultEnvNameField,
+		valueField: defaultEnvValueField,
+	}
+}
+
 // toJson returns json value that can be used as a "secrets" array element of
-// an ECS task definition. It derives variable name from the secret name.
-func toJson(name, arn string) string {
+// an ECS task definition.
+func toJson(e ecsSecret) string {
+	b, err := json.Marshal(e)
+	if err != nil {
+		panic(err)
+	}
+	return string(b)
+}
+
+// addPrefix prepends prefix to names of all secrets, separating them with "/"
+// unless prefix already ends with it.
+func addPrefix(secrets []secret, prefix string) error {
+	for _, r := range prefix {
+		if !validNameRune(r) {
+			return fmt.Errorf("prefix %q has invalid character %q", prefix, r)
+		}
+	}
+	if !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	for i := range secrets {
+		secrets[i].Name = prefix + secrets[i].Name
+	}
+	return nil
+}
+
+// truncatedHashLength is the number of hex characters of the name hash that
+// truncateName appends.
+const truncatedHashLength = 8
+
+// limitNameLengths checks that secret names aren't longer than max, or
+// shortens those that are with truncateName if truncate is set. Variable
+// names are derived from the original names.
+func limitNameLengths(secrets []secret, max int, truncate bool) error {
+	for i := range secrets {
+		s := &secrets[i]
+		if len(s.Name) <= max {
+			continue
+		}
+		if !truncate {
+			return fmt.Errorf("%s: secret name %q is longer than %d characters, use -truncate-names to shorten it",
+				s.position(), s.Name, max)
+		}
+		name := truncateName(s.Name, max)
+		logInfo("secret name %q truncated to %q", s.Name, name)
+		if s.EnvName == "" {
+			s.EnvName = s.varName()
+		}
+		s.Name = name
+	}
+	return nil
+}
+
+// truncateName shortens name to max characters, replacing its tail with "-"
+// and a hash of the whole name.
+func truncateName(name string, max int) string {
+	sum := sha256.Sum256([]byte(name))
+	keep := max - truncatedHashLength - 1
+	return fmt.Sprintf("%s-%x", name[:keep], sum[:truncatedHashLength/2])
+}
+
+// filenamePrefix returns the base name of the input file or S3 object key
+// without extension, and without the ".gz" one of compressed files.
+func filenamePrefix(file string) (string, error) {
+	var base string
+	if strings.HasPrefix(file, "s3://") {
+		base = path.Base(file)
+	} else {
+		base = filepath.Base(file)
+	}
+	base = strings.TrimSuffix(base, ".gz")
+	base = strings.TrimSuffix(base, path.Ext(base))
+	if base == "" || base == "." || base == "/" {
+		return "", fmt.Errorf("cannot derive prefix from file name %q", file)
+	}
+	return base, nil
+}
+
+// trimEnvPrefix sets variable names of secrets starting with prefix, unless
+// they're set explicitly, deriving them from the whole rest of the name, or
+// label if the secret has one, instead of its last part: with the
+// "company/myapp/" prefix "company/myapp/prod/DB_PASSWORD" becomes
+// PROD_DB_PASSWORD.
+func trimEnvPrefix(secrets []secret, prefix string) {
+	for i := range secrets {
+		s := &secrets[i]
+		name := s.displayName()
+		if s.EnvName != "" || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		rest := strings.TrimPrefix(strings.TrimPrefix(name, prefix), "/")
+		s.EnvName = envName(strings.ReplaceAll(rest, "/", "_"))
+	}
+}
+
+// addSuffix appends suffix to names of all secrets as is. Variable names
+// used in -env and -dotenv output are still derived from names without
+// suffix.
+func addSuffix(secrets []secret, suffix string) error {
+	for _, r := range suffix {
+		if !validNameRune(r) {
+			return fmt.Errorf("suffix %q has invalid character %q", suffix, r)
+		}
+	}
+	for i := range secrets {
+		if secrets[i].EnvName == "" {
+			secrets[i].EnvName = secrets[i].varName()
+		}
+		secrets[i].Name += suffix
+	}
+	return nil
+}
+
+// checkDuplicates returns an error listing secret names that occur more than
+// once, along with their line numbers, prefixed with file names when reading
+// multiple files.
+func checkDuplicates(secrets []secret) error {
+	lines := make(map[string][]string)
+	var names []string
+	for _, s := range secrets {
+		if _, ok := lines[s.Name]; !ok {
+			names = append(names, s.Name)
+		}
+		pos := strconv.Itoa(s.line)
+		if s.file != "" {
+			pos = s.position()
+		}
+		lines[s.Name] = append(lines[s.Name], pos)
+	}
+	var dups []string
+	for _, name := range names {
+		if l := lines[name]; len(l) > 1 {
+			dups = append(dups, fmt.Sprintf("%q (lines %s)", name, strings.Join(l, ", ")))
+		}
+	}
+	if len(dups) != 0 {
+		return fmt.Errorf("duplicate secret names: %s", strings.Join(dups, "; "))
+	}
+	return nil
+}
+
+// filterSecrets returns secrets with names matching any of the only patterns,
+// or all of them if only is empty, except those matching any of the exclude
+// patterns. It reuses the secrets slice.
+func filterSecrets(secrets []secret, only, exclude []string) []secret {
+	matchAny := func(patterns []string, name string) bool {
+		for _, p := range patterns {
+			// patterns are validated by globFlag.Set
+			if ok, _ := path.Match(p, name); ok {
+				return true
+			}
+		}
+		return false
+	}
+	out := secrets[:0]
+	for _, s := range secrets {
+		if len(only) != 0 && !matchAny(only, s.Name) || matchAny(exclude, s.Name) {
+			continue
+		}
+		out = append(out, s)
+	}
+	return out
+}
+
+// checkEnvNames returns an error listing names derived from secrets with the
+// name function, i.e. environment variable names, that multiple secrets map
+// to. Kind describes these names in the error message.
+func checkEnvNames(secrets []secret, kind string, name func(*secret) string) error {
+	names := make(map[string][]string) // derived name to secret names
+	var vars []string
+	for i := range secrets {
+		s := &secrets[i]
+		v := name(s)
+		if _, ok := names[v]; !ok {
+			vars = append(vars, v)
+		}
+		names[v] = append(names[v], strconv.Quote(s.Name))
+	}
+	var dups []string
+	for _, v := range vars {
+		if n := names[v]; len(n) > 1 {
+			dups = append(dups, fmt.Sprintf("%s (secrets %s)", v, strings.Join(n, ", ")))
+		}
+	}
+	if len(dups) != 0 {
+		return fmt.Errorf("multiple secrets map to the same %s: %s", kind, strings.Join(dups, "; "))
+	}
+	return nil
+}
+
+// checkEmptyNames returns an error if name maps any of the secrets to an empty
+// string, i.e. a secret name without letters, like "123/456". Kind describes
+// derived names in the error message.
+func checkEmptyNames(secrets []secret, kind string, name func(*secret) string) error {
+	for i := range secrets {
+		s := &secrets[i]
+		if name(s) == "" {
+			return fmt.Errorf("%s: secret %q maps to an empty %s, set one explicitly with the env_name column",
+				s.position(), s.Name, kind)
+		}
+	}
+	return nil
+}
+
+// varName returns environment variable name for the secret: either set
+// explicitly with the env_name column, or derived from the secret name, or
+// from its label if it has one.
+func (s *secret) varName() string {
+	if s.EnvName != "" {
+		return s.EnvName
+	}
+	return envName(s.displayName())
+}
+
+// displayName returns the secret label, if it has one, or its name, to identify
+// the secret in log messages.
+func (s *secret) displayName() string {
+	if s.label != "" {
+		return s.label
+	}
+	return s.Name
+}
+
+// cfnID returns CloudFormation logical ID for the secret, derived from its
+// environment variable name: DB_PASSWORD becomes DbPassword. Logical IDs can
+// only be alphanumeric.
+func (s *secret) cfnID() string {
+	var b strings.Builder
+	for _, word := range strings.Split(s.varName(), "_") {
+		first := true
+		for _, r := range word {
+			if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9') {
+				continue
+			}
+			if first {
+				b.WriteRune(unicode.ToUpper(r))
+				first = false
+				continue
+			}
+			b.WriteRune(unicode.ToLower(r))
+		}
+	}
+	return b.String()
+}
+
+// envName derives environment variable name from the secret name.
+func envName(name string) string {
 	if i := strings.LastIndexByte(name, '/'); i != -1 {
 		name = name[i+1:]
 	}
-	name = strings.Map(func(r rune) rune {
+	return strings.Map(func(r rune) rune {
 		switch r {
-		case ' ', '-', '_':
+		case ' ', '-', '_', '.':
 			return '_'
 		}
 		if r >= 'A' && r <= 'Z' {
@@ -138,22 +3366,483 @@ func toJson(name, arn string) string {
 		}
 		return -1
 	}, strings.ToUpper(name))
-	b, err := json.Marshal(struct {
-		Name  string `json:"name"`
-		Value string `json:"valueFrom"`
-	}{Name: name, Value: arn})
-	if err != nil {
-		panic(err)
+}
+
+// fixEnvName removes control characters from an explicitly set variable name,
+// replaces other characters except ASCII letters, digits, and underscores with
+// underscores, and prepends an underscore if it starts with a digit. If strict
+// is true, it returns an error for names needing these fixes instead.
+func fixEnvName(name string, strict bool) (string, error) {
+	if strict {
+		for _, r := range name {
+			if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_') {
+				return "", fmt.Errorf("env_name %q has invalid character %q", name, r)
+			}
+		}
+		if name[0] >= '0' && name[0] <= '9' {
+			return "", fmt.Errorf("env_name %q starts with a digit", name)
+		}
+		return name, nil
 	}
-	return string(b)
+	fixed := strings.Map(func(r rune) rune {
+		switch {
+		case unicode.IsControl(r):
+			return -1
+		case r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_':
+			return r
+		}
+		return '_'
+	}, name)
+	if fixed == "" {
+		return "", fmt.Errorf("env_name %q has only control characters", name)
+	}
+	if fixed[0] >= '0' && fixed[0] <= '9' {
+		fixed = "_" + fixed
+	}
+	return fixed, nil
+}
+
+// countTrue returns the number of true values.
+func countTrue(values ...bool) int {
+	var n int
+	for _, v := range values {
+		if v {
+			n++
+		}
+	}
+	return n
 }
 
 func init() {
 	flag.Usage = func() {
-		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] path/to/file.csv\n", filepath.Base(os.Args[0]))
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] path/to/file.csv...\n", filepath.Base(os.Args[0]))
+		fmt.Fprintf(flag.CommandLine.Output(), "       %s [flags] -export prefix\n", filepath.Base(os.Args[0]))
 		flag.PrintDefaults()
-		fmt.Fprintln(flag.CommandLine.Output(),
-			"\ncsv file must have a header, inspected fields are: "+
-				"'name', 'value', and 'description' (optional)")
+		fmt.Fprint(flag.CommandLine.Output(), usageTail)
 	}
 }
+
+const usageTail = `
+Use "-" as a file name to read from stdin, or s3://bucket/key URL to
+read it from S3. Files with the .gz extension, or any input when run with
+the -gzip flag, are decompressed, i.e. "secrets.json.gz" is read as a
+gzip-compressed JSON. Multiple files may be given, their secrets are
+processed in the order of files, and names must be unique across all of
+them.
+
+CSV file must have a header, inspected columns are:
+
+	name			secret name, or a label if secret_name is set
+	secret_name		secret name overriding name (optional)
+	value			secret value
+	value_file		path to file to read secret value from, alternative to value
+	value_base64		base64-encoded binary secret value, alternative to value
+	description		secret description, see -description-column (optional)
+	tags			semicolon-separated key=value pairs (optional)
+	env_name		variable name for -env and -dotenv output (optional)
+	key			key of a JSON secret value to reference in -env, -cfn, and -gha output (optional)
+	json_key		alias of key, for files made for earlier versions (optional)
+	kms_key			KMS key to encrypt secret with (optional)
+	version_stages		semicolon-separated staging labels of the version (optional)
+	overwrite		true to update the secret if it exists with -exists fail or skip (optional)
+	rotation_lambda_arn	ARN of the rotation Lambda function (optional)
+	rotation_days		days between automatic rotations (optional)
+
+Column names are matched ignoring case and surrounding spaces, so "Name"
+or " value " work too. Tags are given as a semicolon-separated list of
+key=value pairs, i.e. "team=web;env=prod". Tags set with the -tag flag,
+i.e. -tag team=web, are applied to all secrets, tags from the "tags"
+column take precedence over them. Values of -tag flags cannot contain "=",
+use the column or a tags file for such values. Common tags can also be
+read from a JSON object with string values, i.e. {"team": "web"}, in a
+file set with the -tags-file flag; -tag flags take precedence over tags
+from this file.
+
+Templates that call the description column differently, like "desc" or
+"notes", can be read with the -description-column flag naming it, i.e.
+-description-column notes. It takes a comma-separated list of columns, of
+which the first one present in the header holds descriptions, so
+-description-column description,desc,notes reads files of all these
+templates. Other columns, including "description" if it's not listed, are
+not used for descriptions then.
+
+When spreadsheet identifiers aren't the names secrets should have, an
+optional "secret_name" column sets the Secrets Manager name. Rows with it
+set use "name" only as a label in log messages and to derive variable names
+from, so precedence for the variable name is "env_name", then "name", and
+for the secret name it's "secret_name", then "name". Flags changing names,
+like -name-transform or -prefix, apply to the secret name.
+
+Secrets without a description get the one set with the -description flag,
+with {name} replaced by the secret name. For descriptions made of multiple
+columns, the -description-template flag names a file with a text/template
+template executed for each row of CSV input, with .Name set to the secret
+name and .Columns to a map of all columns, except "value" and
+"value_base64", by lowercase name, i.e.
+
+	{{.Name}} owned by {{.Columns.team}}, see {{.Columns.runbook}}
+
+Surrounding whitespace of the result is trimmed. Referencing a missing
+column is an error.
+
+Blank lines are ignored. Rows with empty name and value, like ",,", which
+generated files sometimes end with, are an error, unless the
+-skip-empty-rows flag is set, in which case they're skipped, also when
+these cells only have spaces and -trim is set. Other columns, like
+description or tags, don't matter, but rows with only one of name and
+value set are still an error. Value here is any of the "value",
+"value_file", and "value_base64" columns, or the ones making the value with
+-json-secret and -json-keys.
+
+Lines starting with "#" are ignored as comments, the -comment flag changes
+this character. Comment character is only recognized at the very beginning
+of a line, it cannot be the same as the field delimiter or a quote, and
+lines inside quoted multi-line values are never treated as comments.
+
+Values with commas, quotes, or line breaks must be quoted, with quotes
+inside doubled, i.e. "a ""quoted"" word". Hand-edited files often get this
+wrong, the -lazy-quotes flag tolerates quotes appearing in unquoted values
+and unescaped quotes in quoted ones. With this flag "\r\n" line breaks in
+quoted values are read as "\n".
+
+Files with the .json extension, or any input when run with -format=json, are
+read as JSON array of objects with the same fields as CSV columns, with
+tags given as an object, i.e.
+
+	[{"name": "db", "value": "secret", "tags": {"team": "web"}}]
+
+Files with the .env extension, or any input when run with -format=env, are
+read as KEY=value lines, with keys used as secret names. Blank lines and
+lines starting with "#" are ignored. Values can be quoted: double-quoted
+ones support \n, \t, \", and \\ escapes, single-quoted ones are taken
+literally, and both can span multiple lines.
+
+Instead of the "value" column, a "value_file" column may be used to read
+secret value from a file, which is convenient for multi-line values like
+certificates or keys. Relative paths are resolved against the directory of
+the CSV file. Binary secrets can be set with a base64-encoded
+"value_base64" column. Only one of these value columns can be set per row.
+
+Values of the most sensitive secrets can be kept out of files altogether
+with the -interactive-values flag: input then only has names and metadata
+columns like "description", and program asks for each value on the
+terminal, without echoing it. Stdin must be a terminal in this mode.
+
+Secrets are encrypted with the AWS managed key by default. The -kms-key flag
+sets a KMS key for all secrets, and a "kms_key" column sets it per secret,
+taking precedence over the flag. If the column is present, it must be set
+for every row, unless the -kms-key flag is also set.
+
+Rotation is configured for secrets with "rotation_lambda_arn" and
+"rotation_days" columns set, they must be used together. Rotation is only
+scheduled, secrets are not rotated right after they're created, so they keep
+values from the file until the first scheduled rotation.
+
+A "version_stages" column sets semicolon-separated staging labels of the
+stored secret version, i.e. "AWSCURRENT;green". Versions stored for
+existing secrets get only these labels, so a value can be staged without
+making it current by leaving AWSCURRENT out. The first version of a new
+secret is always AWSCURRENT, other labels are added to it.
+
+With the -json-secret flag, each row makes a secret which value is a JSON
+object built from all columns except "name", "secret_name", "description",
+"tags", "env_name", "key", "json_key", "kms_key", "version_stages",
+"overwrite", and rotation ones, with column names used as keys. For
+example, CSV file
+
+	name,username,password
+	db,admin,secret
+
+makes a secret "db" with the value {"username":"admin","password":"secret"}.
+Values are always stored as JSON strings: a cell with a valid JSON, like 42
+or {"a":1}, is not embedded as is, and becomes "42" or "{\"a\":1}" string.
+To only use some of the columns, list them with the -json-keys flag instead,
+i.e. -json-keys username,password; other columns are then ignored, except
+"name" and metadata columns like "description".
+
+With the -expand flag, ${VAR} and $VAR references in values are replaced
+with environment variables, so that a file can be committed with
+placeholders like ${DB_PASSWORD} instead of actual secrets. Referencing an
+undefined variable is an error, use $$ for a literal $. Values read with
+"value_file" or "value_base64" are not expanded.
+
+Values are stored byte for byte, so a multi-line cell pasted on Windows
+keeps its "\r\n" line endings. With the -normalize-newlines flag "\r\n" and
+lone "\r" in values, including ones read with "value_file", are converted
+to "\n". Binary values from "value_base64" are never changed.
+
+Creating secrets:
+
+With the -verify flag program reads back the value of each stored secret and
+fails if it differs from the input, to catch truncation or encoding issues.
+This needs the secretsmanager:GetSecretValue permission, and kms:Decrypt for
+secrets encrypted with a customer managed key, and makes one more request
+per secret, which is billed as other API calls. It cannot be used with
+-exists=merge-json, as merged values differ from the input.
+
+Throttled CreateSecret and PutSecretValue requests are retried up to
+-max-retries times, with exponential backoff and jitter. To avoid
+throttling altogether, the -rate flag limits Secrets Manager requests to a
+given number per second, shared by all -concurrency workers. Write requests
+like CreateSecret and PutSecretValue are limited to 50 per second per
+region for the whole account, so for bulk imports -rate from 10 to 25
+leaves room for other clients. For coarser control, the -batch-size flag
+processes secrets in batches of a given size, each one finished before the
+next starts, and the -batch-pause flag sleeps between batches, i.e.
+-batch-size 100 -batch-pause 1m. Interrupting the program or hitting
+-timeout during a pause stops it the same way as during a batch.
+
+By default program stops on the first secret that already exists. Use the
+-exists flag to either skip such secrets, update their values, or replace
+their values, descriptions, and tags to match the CSV file. With
+-exists=merge-json values must be JSON objects, which are merged into the
+existing JSON object values, so that secrets like RDS credentials can be
+built up incrementally; keys from the input take precedence. An "overwrite"
+column overrides -exists=fail and -exists=skip per row: rows with it set to
+true, 1, or yes, in any case, update existing secrets, while other rows,
+with false, 0, no, or an empty cell, follow the -exists flag. With
+-exists=update, replace, or merge-json, which already change existing
+secrets, the column has no effect.
+
+Deleted secrets stay scheduled for deletion during their recovery window,
+and their names cannot be reused until then. By default program fails on
+such secrets. With the -restore flag it restores them instead, and then
+handles them as existing secrets according to -exists, except that with the
+default -exists=fail their values, descriptions, and tags are replaced.
+
+Secrets Manager has a quota on the number of secrets per region, so large
+imports can fail midway. With the -max-secrets flag program counts existing
+secrets before creating new ones, and warns if their total would exceed the
+given limit. With -strict-quota it fails in this case instead.
+
+The -policy-file flag attaches a resource-based policy from a JSON file to
+all secrets. Policies allowing broad access, like public or cross-account
+ones with wildcard principals, are rejected unless -block-public-policy=false
+is set.
+
+The -name-transform flag enforces a naming convention: "lower" and "upper"
+change the case of names, and "slug" makes them lowercase, replaces spaces
+with hyphens, and drops characters not allowed in secret names, i.e.
+"My App/DB Password!" becomes "my-app/db-password". Names are transformed
+as they're read, before other flags like -prefix are applied, and must still
+be valid afterwards. With -verbose, changed names are logged.
+
+The -prefix flag adds a common prefix to all secret names, i.e. -prefix
+myapp/prod turns "db" into "myapp/prod/db". Variable names in the -env
+output are still derived from the last part of the name only. Similarly,
+the -suffix flag appends a suffix as is, i.e. -suffix -v2 turns "db" into
+"db-v2", and doesn't change variable names either, so the variable is still
+DB. With both flags set, -prefix myapp -suffix -v2 turns "db" into
+"myapp/db-v2".
+
+The -prefix-from-filename flag prefixes names with the base name of the
+input file without extension, so that "prod-db.csv" turns "password" into
+"prod-db/password". With multiple files each one gets its own prefix. It
+composes with -prefix, which goes first: -prefix myapp makes it
+"myapp/prod-db/password". It cannot be used with input from stdin.
+
+Names with -prefix and -suffix applied can't be longer than 512 characters,
+or than the -max-name-length limit if it's lower. Over-length names are an
+error by default; with -truncate-names they're shortened deterministically
+instead, keeping as much of the name as fits and appending "-" and 8 hex
+characters of its SHA-256 hash, so that distinct names stay distinct and
+repeated runs produce the same result. Every truncated name is logged along
+with the original one.
+
+To only process some of the secrets, use the -only and -exclude flags with
+glob patterns of path.Match syntax, i.e. -only 'myapp/*'. Both can be
+repeated. Secrets are kept if they match any of the -only patterns, or if
+there are none, and match none of the -exclude patterns. Patterns are
+matched against names with -prefix and -suffix applied.
+
+The -endpoint-url flag, or the AWS_ENDPOINT_URL environment variable, sends
+all AWS requests to a different endpoint, which is useful for testing with
+local emulators like LocalStack.
+
+The -expect-region flag guards against misconfigured environments: program
+fails if the AWS region it's about to use is different, and checks that ARNs
+of all secrets are in this region before outputting them.
+
+Credentials are looked up the usual way for AWS tools. The
+-credentials-file flag reads them from a shared credentials file at a
+different path instead, using the -profile section of it, or the default
+one.
+
+Diagnostic messages, including whether each secret was created, updated,
+replaced, or skipped, are logged to stderr, the -log-json flag makes them
+JSON lines with "time", "level", and "msg" fields, or "secret", "event",
+and "error" fields for events related to individual secrets. Secret values
+are never logged. Once all secrets are processed, a summary with their
+counts by outcome is logged, i.e. "created: 198, updated: 0, replaced: 0,
+skipped: 2, failed: 0", whatever the output format.
+
+Default flag values can be set in a JSON config file, which is read from
+.aws-add-secrets.json in the working directory if it exists, or from a
+file set with the -config flag. Config is an object with flag names as
+keys, and arrays of values for flags that can be repeated:
+
+	{"region": "eu-west-1", "profile": "prod", "tag": ["team=web"]}
+
+Flags set on the command line take precedence over the config, and config
+takes precedence over built-in defaults. A repeatable flag set on the
+command line replaces all its values from the config, i.e. any -tag flag
+discards tags from the config. Flags selecting what the program does or
+confirming destructive actions, -delete, -export, -yes, and
+-recovery-window, can only be set on the command line, so that a config
+file found in the working directory can't turn a run into a deletion.
+
+By default program stops at the first secret it fails to create. With the
+-continue-on-error flag it processes all remaining secrets, outputs those
+that succeeded, and reports every failure at the end. This flag cannot be
+used with -rollback.
+
+Program exits with status 0 on success, and 1 on failure when no secrets
+were changed, i.e. on input validation errors, or if the very first secret
+could not be created. If it fails after some secrets were already created,
+updated, or deleted, and not rolled back with -rollback, exit status is 2.
+
+Output formats:
+
+Program outputs ARNs of each secret created, or name and ARN tab-separated
+with the -with-name flag, which helps to tell which secret each ARN belongs
+to. With the -env flag it outputs JSON lines suitable for the "secrets"
+section of ECS container task definition instead, and with the -env-array
+flag a single JSON array of such records, which can be used as the
+"secrets" section as is. Records have "name" and "valueFrom" keys as ECS
+expects; other systems may need different keys, which can be set with the
+-env-name-field and -env-value-field flags. With the -dotenv flag it
+outputs NAME=ARN lines in a .env file format. Variable names are derived
+from the last part of the secret name, i.e. "myapp/db.password" becomes
+DB_PASSWORD, unless set explicitly with an "env_name" column, which is
+required for names without letters, like "123/456". With the
+-env-trim-prefix flag names starting with a given prefix keep all their
+parts after it instead: with the "company/myapp/" prefix
+"company/myapp/prod/DB_PASSWORD" becomes PROD_DB_PASSWORD. The prefix is
+matched against names from the input, before the -prefix flag is applied.
+
+Variable names set with "env_name" have control characters, like line
+breaks from quoted CSV cells, removed, other characters except ASCII
+letters, digits, and underscores replaced with underscores, and those
+starting with a digit get an underscore prepended, so that 1_TOKEN becomes
+_1_TOKEN and "DB-PASSWORD" becomes DB_PASSWORD. With the -strict-env-names
+flag such names are an error instead.
+
+Secrets with JSON values can have a "key" column set, in which case
+-env, -env-array, -cfn, and -gha output references this key of the JSON
+value instead of the whole value, i.e. "valueFrom" is "arn:...:password::"
+for a "password" key. A "json_key" column is read the same way, as an alias
+of "key" kept for existing files; a row cannot have both set.
+
+To prepare task definitions before secrets exist, the -predict-arn flag
+with a region and account, i.e. -predict-arn us-east-1:123456789012, outputs
+-env or -env-array records with ARNs computed from secret names, without
+making any AWS calls or creating anything. Predicted ARNs are approximate:
+AWS appends a hyphen and 6 random characters to the ARN of every secret it
+creates, which can't be known in advance, so predicted ones end with the
+name only. Such partial ARNs work where Secrets Manager resolves them, but
+may need to be replaced with real ones once secrets are created.
+
+With the -cfn flag it outputs a JSON object mapping CloudFormation logical
+IDs to dynamic references of secrets, i.e.
+
+	{"DbPassword": "{{resolve:secretsmanager:arn:aws:secretsmanager:...}}"}
+
+Logical IDs are derived from variable names with underscores removed and
+words capitalized.
+
+With the -terraform flag it outputs a Terraform aws_secretsmanager_secret
+resource for each secret, preceded by a comment with the "terraform import"
+command to bring the secret under Terraform management. Resource names are
+derived from secret names, i.e. "myapp/db.password" becomes
+myapp_db_password, with numeric suffixes added to keep them unique.
+
+With the -k8s-externalsecret flag it outputs an ExternalSecret manifest of
+the External Secrets Operator for each secret, as a separate YAML document
+commented with the secret ARN. Each manifest makes a Kubernetes secret with
+a single key, named the same as the -env variable, which is fetched from the
+secret by its name; secrets with a "key" column set only fetch this key
+of the JSON value. Manifests refer to a SecretStore named with the
+-k8s-secret-store flag. Object names are derived from secret names, i.e.
+"myapp/DB_password" becomes myapp-db-password, with numeric suffixes added
+to keep them unique.
+
+With the -gha flag it outputs variable names and ARNs of secrets for the
+env block of a GitHub Actions workflow, so that steps running with an
+assumed role, i.e. with OIDC, can fetch them by ARN:
+
+	env:
+	  DB_PASSWORD: "arn:aws:secretsmanager:..."
+
+With -gha-format=json it outputs a single JSON object mapping variable
+names to ARNs instead, which can be stored as a workflow variable, and with
+-gha-format=step a step of the aws-actions/aws-secretsmanager-get-secrets
+action, which fetches secrets into environment variables of the job:
+
+	steps:
+	  - uses: aws-actions/aws-secretsmanager-get-secrets@v2
+	    with:
+	      secret-ids: |
+	        DB_PASSWORD,arn:aws:secretsmanager:...
+
+Variable names are the same as in -env output, and so are ARNs of secrets
+with a "key" column set, which end with the key. The action fetches whole
+values, so such secrets can't be used with -gha-format=step.
+
+With the -json flag it outputs a single JSON document once all secrets are
+processed, with a "secrets" array of objects with "name", "arn",
+"versionId", and "status" fields, and a "summary" object with counts of
+secrets by status. Combined with -continue-on-error, the array also has
+secrets that failed, with "failed" status and an "error" field. If the run
+stops early because a secret failed, it was interrupted, or it timed out,
+the document is still output, with the secrets processed so far and an
+"error" field with the reason; with -output the file is written in this
+case too.
+
+Output follows the order of the input, rows of each file and files in the
+order given, even with -concurrency above 1 or -batch-size: each secret is
+output once it and all secrets before it are processed. This holds for all
+output formats, including -env and -env-array records, so repeated runs
+with the same input only differ where ARNs or version ids do, and diff
+cleanly. With the -sort flag secrets are processed and output in name order
+instead, which makes output reproducible regardless of the input order. The
+-stream flag additionally flushes stdout after each secret, which gives
+feedback during long runs; it cannot be used with -env-array, -cfn, and
+-gha-format=json, which only output once all secrets are processed. For long runs the
+-progress flag also reports progress to stderr as "created 45/200",
+updating a single line in place if stderr is a terminal, or logging a line
+every few seconds otherwise. The count includes all processed secrets, so
+ones skipped or updated with -exists are counted as created too.
+
+Other modes:
+
+With the -export flag program works in reverse: it writes existing secrets
+with names starting with a given prefix to stdout as CSV, in the same format
+it accepts as input, with values quoted as needed, so that it can be read
+back as is. Use -no-values to only export names and descriptions:
+
+	aws-add-secrets -export myapp/ > backup.csv
+
+With the -delete flag program deletes secrets listed in a file, which only
+needs the "name" column, and outputs their deletion dates. Deleted secrets
+can be restored within 30 days, the -recovery-window flag changes this
+period, and 0 deletes secrets without recovery. As a safeguard, -delete
+requires the -yes flag. Output is always lines of names and deletion dates,
+so output format flags like -env, -json, or -with-name cannot be used with
+-delete.
+
+With the -interactive flag program lists names of secrets and asks for
+confirmation before creating them. Prompt is skipped if stdin is not a
+terminal, so that such runs don't hang in CI.
+
+With the -dry-run flag program only validates the CSV file and reports what
+it would do for each secret, without changing anything. The -diff flag
+compares secrets with the existing ones and reports for each whether it's
+new, unchanged, or has changed value or description; secret values are
+never printed. In this mode program exits with non-zero status if any
+differences are found, so it can be used as a check in CI.
+
+Since -dry-run may call AWS to check whether secrets exist, there's also the
+-validate-only flag, which only reads and validates input files and exits,
+without making any network calls. It can be used in a pre-commit hook, but
+cannot read files from S3.
+`
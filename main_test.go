@@ -0,0 +1,1761 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/awsutil"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+)
+
+func TestMain(m *testing.M) {
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// fakeSecret is a secret stored by fakeClient.
+type fakeSecret struct {
+	arn         string
+	value       *string
+	binary      []byte
+	description string
+	tags        map[string]string
+	version     string
+	deleted     bool
+}
+
+// fakeClient is an in-memory secretsClient. Calls for operations it doesn't
+// implement panic on the nil embedded interface.
+type fakeClient struct {
+	secretsClient
+
+	mu      sync.Mutex
+	secrets map[string]*fakeSecret
+	calls   map[string]int // by operation name
+	creates []*secretsmanager.CreateSecretInput
+	nextID  int
+
+	// errs are returned instead of calling an operation, keyed by
+	// operation name and secret name separated by a space, i.e.
+	// "CreateSecret db"
+	errs map[string]error
+	// delays are applied to every call for a secret name
+	delays map[string]time.Duration
+}
+
+func newFakeClient() *fakeClient {
+	return &fakeClient{
+		secrets: make(map[string]*fakeSecret),
+		calls:   make(map[string]int),
+		errs:    make(map[string]error),
+		delays:  make(map[string]time.Duration),
+	}
+}
+
+// add stores an existing secret with a string value.
+func (c *fakeClient) add(name, value, description string, tags map[string]string) *fakeSecret {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := &fakeSecret{
+		arn:         fakeARN(name),
+		value:       aws.String(value),
+		description: description,
+		tags:        tags,
+		version:     c.newVersion(),
+	}
+	c.secrets[name] = s
+	return s
+}
+
+func fakeARN(name string) string {
+	return "arn:aws:secretsmanager:us-east-1:123456789012:secret:" + name + "-AbCdEf"
+}
+
+func (c *fakeClient) newVersion() string {
+	c.nextID++
+	return fmt.Sprintf("v%d", c.nextID)
+}
+
+// call counts a call of operation for secret id, waits for its delay, and
+// returns the secret name and an injected error, if any. It must be called
+// without c.mu held.
+func (c *fakeClient) call(ctx aws.Context, op, id string) (string, error) {
+	c.mu.Lock()
+	name := id
+	for n, s := range c.secrets {
+		if s.arn == id {
+			name = n
+		}
+	}
+	c.calls[op]++
+	err := c.errs[op+" "+name]
+	d := c.delays[name]
+	c.mu.Unlock()
+	if d > 0 {
+		t := time.NewTimer(d)
+		defer t.Stop()
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			return name, ctx.Err()
+		}
+	}
+	return name, err
+}
+
+func (c *fakeClient) count(op string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.calls[op]
+}
+
+func notFound(name string) error {
+	return awserr.New(secretsmanager.ErrCodeResourceNotFoundException, "secret "+name+" not found", nil)
+}
+
+func (c *fakeClient) CreateSecretWithContext(ctx aws.Context, in *secretsmanager.CreateSecretInput, _ ...request.Option) (*secretsmanager.CreateSecretOutput, error) {
+	name, err := c.call(ctx, "CreateSecret", *in.Name)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.creates = append(c.creates, in)
+	if s, ok := c.secrets[name]; ok {
+		if s.deleted {
+			return nil, awserr.New(secretsmanager.ErrCodeInvalidRequestException,
+				"You can't perform this operation on the secret because it was marked for deletion.", nil)
+		}
+		return nil, awserr.New(secretsmanager.ErrCodeResourceExistsException, "secret "+name+" already exists", nil)
+	}
+	s := &fakeSecret{
+		arn:         fakeARN(name),
+		value:       in.SecretString,
+		binary:      in.SecretBinary,
+		description: aws.StringValue(in.Description),
+		tags:        make(map[string]string),
+		version:     c.newVersion(),
+	}
+	for _, t := range in.Tags {
+		s.tags[*t.Key] = *t.Value
+	}
+	c.secrets[name] = s
+	return &secretsmanager.CreateSecretOutput{ARN: &s.arn, Name: in.Name, VersionId: aws.String(s.version)}, nil
+}
+
+func (c *fakeClient) DescribeSecretWithContext(ctx aws.Context, in *secretsmanager.DescribeSecretInput, _ ...request.Option) (*secretsmanager.DescribeSecretOutput, error) {
+	name, err := c.call(ctx, "DescribeSecret", *in.SecretId)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s, ok := c.secrets[name]
+	if !ok {
+		return nil, notFound(name)
+	}
+	out := &secretsmanager.DescribeSecretOutput{
+		ARN:                &s.arn,
+		Name:               aws.String(name),
+		VersionIdsToStages: map[string][]*string{s.version: {aws.String("AWSCURRENT")}},
+	}
+	if s.description != "" {
+		out.Description = aws.String(s.description)
+	}
+	if s.deleted {
+		out.DeletedDate = aws.Time(time.Now())
+	}
+	for k, v := range s.tags {
+		out.Tags = append(out.Tags, &secretsmanager.Tag{Key: aws.String(k), Value: aws.String(v)})
+	}
+	return out, nil
+}
+
+func (c *fakeClient) GetSecretValueWithContext(ctx aws.Context, in *secretsmanager.GetSecretValueInput, _ ...request.Option) (*secretsmanager.GetSecretValueOutput, error) {
+	name, err := c.call(ctx, "GetSecretValue", *in.SecretId)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s, ok := c.secrets[name]
+	if !ok {
+		return nil, notFound(name)
+	}
+	return &secretsmanager.GetSecretValueOutput{
+		ARN:          &s.arn,
+		Name:         aws.String(name),
+		SecretString: s.value,
+		SecretBinary: s.binary,
+		VersionId:    aws.String(s.version),
+	}, nil
+}
+
+func (c *fakeClient) PutSecretValueWithContext(ctx aws.Context, in *secretsmanager.PutSecretValueInput, _ ...request.Option) (*secretsmanager.PutSecretValueOutput, error) {
+	name, err := c.call(ctx, "PutSecretValue", *in.SecretId)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s, ok := c.secrets[name]
+	if !ok {
+		return nil, notFound(name)
+	}
+	s.value, s.binary, s.version = in.SecretString, in.SecretBinary, c.newVersion()
+	return &secretsmanager.PutSecretValueOutput{ARN: &s.arn, Name: aws.String(name), VersionId: aws.String(s.version)}, nil
+}
+
+func (c *fakeClient) UpdateSecretWithContext(ctx aws.Context, in *secretsmanager.UpdateSecretInput, _ ...request.Option) (*secretsmanager.UpdateSecretOutput, error) {
+	name, err := c.call(ctx, "UpdateSecret", *in.SecretId)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s, ok := c.secrets[name]
+	if !ok {
+		return nil, notFound(name)
+	}
+	if in.Description != nil {
+		s.description = *in.Description
+	}
+	return &secretsmanager.UpdateSecretOutput{ARN: &s.arn, Name: aws.String(name)}, nil
+}
+
+func (c *fakeClient) TagResourceWithContext(ctx aws.Context, in *secretsmanager.TagResourceInput, _ ...request.Option) (*secretsmanager.TagResourceOutput, error) {
+	name, err := c.call(ctx, "TagResource", *in.SecretId)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s, ok := c.secrets[name]
+	if !ok {
+		return nil, notFound(name)
+	}
+	for _, t := range in.Tags {
+		s.tags[*t.Key] = *t.Value
+	}
+	return &secretsmanager.TagResourceOutput{}, nil
+}
+
+func (c *fakeClient) UntagResourceWithContext(ctx aws.Context, in *secretsmanager.UntagResourceInput, _ ...request.Option) (*secretsmanager.UntagResourceOutput, error) {
+	name, err := c.call(ctx, "UntagResource", *in.SecretId)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s, ok := c.secrets[name]
+	if !ok {
+		return nil, notFound(name)
+	}
+	for _, k := range in.TagKeys {
+		delete(s.tags, *k)
+	}
+	return &secretsmanager.UntagResourceOutput{}, nil
+}
+
+func (c *fakeClient) RestoreSecretWithContext(ctx aws.Context, in *secretsmanager.RestoreSecretInput, _ ...request.Option) (*secretsmanager.RestoreSecretOutput, error) {
+	name, err := c.call(ctx, "RestoreSecret", *in.SecretId)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s, ok := c.secrets[name]
+	if !ok {
+		return nil, notFound(name)
+	}
+	s.deleted = false
+	return &secretsmanager.RestoreSecretOutput{ARN: &s.arn, Name: aws.String(name)}, nil
+}
+
+func (c *fakeClient) DeleteSecretWithContext(ctx aws.Context, in *secretsmanager.DeleteSecretInput, _ ...request.Option) (*secretsmanager.DeleteSecretOutput, error) {
+	name, err := c.call(ctx, "DeleteSecret", *in.SecretId)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s, ok := c.secrets[name]
+	if !ok {
+		return nil, notFound(name)
+	}
+	if aws.BoolValue(in.ForceDeleteWithoutRecovery) {
+		delete(c.secrets, name)
+	} else {
+		s.deleted = true
+	}
+	return &secretsmanager.DeleteSecretOutput{ARN: &s.arn, Name: aws.String(name), DeletionDate: aws.Time(time.Now())}, nil
+}
+
+func (c *fakeClient) ListSecretsPagesWithContext(ctx aws.Context, in *secretsmanager.ListSecretsInput, fn func(*secretsmanager.ListSecretsOutput, bool) bool, _ ...request.Option) error {
+	if _, err := c.call(ctx, "ListSecrets", ""); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	out := &secretsmanager.ListSecretsOutput{}
+	for name, s := range c.secrets {
+		if s.deleted {
+			continue
+		}
+		e := &secretsmanager.SecretListEntry{ARN: aws.String(s.arn), Name: aws.String(name)}
+		if s.description != "" {
+			e.Description = aws.String(s.description)
+		}
+		out.SecretList = append(out.SecretList, e)
+	}
+	c.mu.Unlock()
+	fn(out, true)
+	return nil
+}
+
+func (c *fakeClient) UpdateSecretVersionStageWithContext(ctx aws.Context, in *secretsmanager.UpdateSecretVersionStageInput, _ ...request.Option) (*secretsmanager.UpdateSecretVersionStageOutput, error) {
+	if _, err := c.call(ctx, "UpdateSecretVersionStage", *in.SecretId); err != nil {
+		return nil, err
+	}
+	return &secretsmanager.UpdateSecretVersionStageOutput{}, nil
+}
+
+// useFakeClient makes run use c instead of the Secrets Manager client.
+func useFakeClient(t *testing.T, c *fakeClient) {
+	t.Helper()
+	orig := newSecretsClient
+	newSecretsClient = func(*session.Session) secretsClient { return c }
+	t.Cleanup(func() { newSecretsClient = orig })
+}
+
+// parseArgs parses command line arguments the way main does, with region set
+// so that no AWS configuration is needed.
+func parseArgs(t *testing.T, argv ...string) runArgs {
+	t.Helper()
+	fs := flag.NewFlagSet("aws-add-secrets", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	var args runArgs
+	defineFlags(fs, &args)
+	if err := fs.Parse(append([]string{"-region", "us-east-1"}, argv...)); err != nil {
+		t.Fatal(err)
+	}
+	args.files = fs.Args()
+	return args
+}
+
+// runFake runs the program with argv against c, and returns its output.
+func runFake(t *testing.T, c *fakeClient, argv ...string) (string, error) {
+	t.Helper()
+	useFakeClient(t, c)
+	args := parseArgs(t, argv...)
+	args.output = filepath.Join(t.TempDir(), "output")
+	err := run(context.Background(), args)
+	b, rerr := os.ReadFile(args.output)
+	if rerr != nil && !errors.Is(rerr, os.ErrNotExist) {
+		t.Fatal(rerr)
+	}
+	return string(b), err
+}
+
+// writeFile writes a file with a given name and content to a temporary
+// directory, and returns its path.
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	name = filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(name, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return name
+}
+
+func TestCreateSecret(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		exists   string
+		restore  bool
+		existing string // value of the existing secret, none if empty
+		deleted  bool
+		input    secret
+		status   string
+		value    string // stored value afterwards
+		desc     string // stored description afterwards
+		tags     map[string]string
+		err      string
+	}{
+		{
+			name:   "new",
+			exists: existsFail,
+			input:  secret{Name: "db", Value: "new", Description: "the db"},
+			status: statusCreated,
+			value:  "new",
+			desc:   "the db",
+			tags:   map[string]string{"team": "web"},
+		},
+		{
+			name:     "fail",
+			exists:   existsFail,
+			existing: "old",
+			input:    secret{Name: "db", Value: "new"},
+			err:      `create secret "db": ResourceExistsException`,
+			value:    "old",
+			desc:     "old desc",
+			tags:     map[string]string{"stale": "1"},
+		},
+		{
+			name:     "skip",
+			exists:   existsSkip,
+			existing: "old",
+			input:    secret{Name: "db", Value: "new", Description: "new desc"},
+			status:   statusSkipped,
+			value:    "old",
+			desc:     "old desc",
+			tags:     map[string]string{"stale": "1"},
+		},
+		{
+			name:     "update",
+			exists:   existsUpdate,
+			existing: "old",
+			input:    secret{Name: "db", Value: "new", Description: "new desc"},
+			status:   statusUpdated,
+			value:    "new",
+			desc:     "old desc",
+			tags:     map[string]string{"stale": "1"},
+		},
+		{
+			name:     "replace",
+			exists:   existsReplace,
+			existing: "old",
+			input:    secret{Name: "db", Value: "new", Description: "new desc"},
+			status:   statusReplaced,
+			value:    "new",
+			desc:     "new desc",
+			tags:     map[string]string{"team": "web"},
+		},
+		{
+			name:     "merge-json",
+			exists:   existsMergeJSON,
+			existing: `{"user":"admin","password":"old"}`,
+			input:    secret{Name: "db", Value: `{"password":"new","port":5432}`},
+			status:   statusUpdated,
+			value:    `{"password":"new","port":5432,"user":"admin"}`,
+			desc:     "old desc",
+			tags:     map[string]string{"stale": "1"},
+		},
+		{
+			name:     "merge-json into non-object",
+			exists:   existsMergeJSON,
+			existing: "plain",
+			input:    secret{Name: "db", Value: `{"password":"new"}`},
+			err:      `existing value of secret "db" is not a JSON object`,
+			value:    "plain",
+			desc:     "old desc",
+			tags:     map[string]string{"stale": "1"},
+		},
+		{
+			name:     "overwrite column",
+			exists:   existsFail,
+			existing: "old",
+			input:    secret{Name: "db", Value: "new", Overwrite: true},
+			status:   statusUpdated,
+			value:    "new",
+			desc:     "old desc",
+			tags:     map[string]string{"stale": "1"},
+		},
+		{
+			name:     "overwrite column, exists skip",
+			exists:   existsSkip,
+			existing: "old",
+			input:    secret{Name: "db", Value: "new", Overwrite: true},
+			status:   statusUpdated,
+			value:    "new",
+			desc:     "old desc",
+			tags:     map[string]string{"stale": "1"},
+		},
+		{
+			name:     "overwrite column, exists replace",
+			exists:   existsReplace,
+			existing: "old",
+			input:    secret{Name: "db", Value: "new", Description: "new desc", Overwrite: true},
+			status:   statusReplaced,
+			value:    "new",
+			desc:     "new desc",
+			tags:     map[string]string{"team": "web"},
+		},
+		{
+			name:     "deleted",
+			exists:   existsSkip,
+			existing: "old",
+			deleted:  true,
+			input:    secret{Name: "db", Value: "new"},
+			err:      `secret "db" is scheduled for deletion, use -restore`,
+			value:    "old",
+			desc:     "old desc",
+			tags:     map[string]string{"stale": "1"},
+		},
+		{
+			name:     "deleted, exists fail",
+			exists:   existsFail,
+			existing: "old",
+			deleted:  true,
+			input:    secret{Name: "db", Value: "new"},
+			err:      `secret "db" is scheduled for deletion, use -restore`,
+			value:    "old",
+			desc:     "old desc",
+			tags:     map[string]string{"stale": "1"},
+		},
+		{
+			name:     "deleted restored",
+			exists:   existsFail,
+			restore:  true,
+			existing: "old",
+			deleted:  true,
+			input:    secret{Name: "db", Value: "new", Description: "new desc"},
+			status:   statusReplaced,
+			value:    "new",
+			desc:     "new desc",
+			tags:     map[string]string{"team": "web"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c := newFakeClient()
+			if tc.existing != "" {
+				s := c.add("db", tc.existing, "old desc", map[string]string{"stale": "1"})
+				s.deleted = tc.deleted
+			}
+			tc.input.Tags = []*secretsmanager.Tag{{Key: aws.String("team"), Value: aws.String("web")}}
+			o, err := createSecret(context.Background(), c, tc.input, createOptions{exists: tc.exists, restore: tc.restore})
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Fatalf("got error %v, want one containing %q", err, tc.err)
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			if o.status != tc.status {
+				t.Errorf("got status %q, want %q", o.status, tc.status)
+			}
+			if tc.status != "" && o.arn != fakeARN("db") {
+				t.Errorf("got ARN %q, want %q", o.arn, fakeARN("db"))
+			}
+			s := c.secrets["db"]
+			if got := aws.StringValue(s.value); got != tc.value {
+				t.Errorf("stored value is %q, want %q", got, tc.value)
+			}
+			if s.description != tc.desc {
+				t.Errorf("stored description is %q, want %q", s.description, tc.desc)
+			}
+			if !reflect.DeepEqual(s.tags, tc.tags) {
+				t.Errorf("stored tags are %v, want %v", s.tags, tc.tags)
+			}
+		})
+	}
+}
+
+func TestCreateSecretErrors(t *testing.T) {
+	boom := awserr.New(secretsmanager.ErrCodeInternalServiceError, "boom", nil)
+	for _, tc := range []struct {
+		name   string
+		exists string
+		op     string // operation failing with boom
+		err    string
+	}{
+		{"create", existsFail, "CreateSecret", `create secret "db": InternalServiceError: boom`},
+		{"describe", existsSkip, "DescribeSecret", "InternalServiceError: boom"},
+		{"put value", existsUpdate, "PutSecretValue", `update secret "db" value: InternalServiceError: boom`},
+		{"update", existsReplace, "UpdateSecret", `update secret "db": InternalServiceError: boom`},
+		{"get value", existsMergeJSON, "GetSecretValue", `get secret "db" value: InternalServiceError: boom`},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c := newFakeClient()
+			if tc.op != "CreateSecret" {
+				c.add("db", `{"a":"b"}`, "", map[string]string{})
+			}
+			c.errs[tc.op+" db"] = boom
+			_, err := createSecret(context.Background(), c, secret{Name: "db", Value: `{"c":"d"}`}, createOptions{exists: tc.exists})
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Fatalf("got error %v, want one containing %q", err, tc.err)
+			}
+			if !errors.Is(err, boom) {
+				t.Errorf("error %v doesn't wrap the AWS error", err)
+			}
+		})
+	}
+}
+
+func TestRunErrors(t *testing.T) {
+	csvFile := func(t *testing.T, content string) string { return writeFile(t, "secrets.csv", content) }
+	for _, tc := range []struct {
+		name  string
+		argv  func(t *testing.T) []string
+		err   string
+		calls bool // whether any AWS calls are expected
+	}{
+		{
+			name: "no input",
+			argv: func(t *testing.T) []string { return nil },
+			err:  "input file missing",
+		},
+		{
+			name: "bad -exists",
+			argv: func(t *testing.T) []string { return []string{"-exists", "ignore", "x.csv"} },
+			err:  `unsupported -exists value: "ignore"`,
+		},
+		{
+			name: "quiet and verbose",
+			argv: func(t *testing.T) []string { return []string{"-quiet", "-verbose", "x.csv"} },
+			err:  "-quiet and -verbose flags are mutually exclusive",
+		},
+		{
+			name: "rollback with continue-on-error",
+			argv: func(t *testing.T) []string { return []string{"-rollback", "-continue-on-error", "x.csv"} },
+			err:  "-continue-on-error and -rollback flags are mutually exclusive",
+		},
+		{
+			name: "delete without confirmation",
+			argv: func(t *testing.T) []string { return []string{"-delete", "x.csv"} },
+			err:  "-delete requires the -yes flag",
+		},
+		{
+			name: "delete with -json",
+			argv: func(t *testing.T) []string { return []string{"-delete", "-yes", "-json", "x.csv"} },
+			err:  "-delete cannot be used with",
+		},
+		{
+			name: "delete with -with-name",
+			argv: func(t *testing.T) []string { return []string{"-delete", "-yes", "-with-name", "x.csv"} },
+			err:  "-delete cannot be used with",
+		},
+		{
+			name: "version id with -dotenv",
+			argv: func(t *testing.T) []string { return []string{"-version-id", "-dotenv", "x.csv"} },
+			err:  "-version-id cannot be used with",
+		},
+		{
+			name: "version id with -cfn",
+			argv: func(t *testing.T) []string { return []string{"-version-id", "-cfn", "x.csv"} },
+			err:  "-version-id cannot be used with",
+		},
+		{
+			name: "version id with -terraform",
+			argv: func(t *testing.T) []string { return []string{"-version-id", "-terraform", "x.csv"} },
+			err:  "-version-id cannot be used with",
+		},
+		{
+			name: "version id with -k8s-externalsecret",
+			argv: func(t *testing.T) []string { return []string{"-version-id", "-k8s-externalsecret", "x.csv"} },
+			err:  "-version-id cannot be used with",
+		},
+		{
+			name: "version id with -gha",
+			argv: func(t *testing.T) []string { return []string{"-version-id", "-gha", "x.csv"} },
+			err:  "-version-id cannot be used with",
+		},
+		{
+			name: "bad -gha-format",
+			argv: func(t *testing.T) []string { return []string{"-gha", "-gha-format", "yaml", "x.csv"} },
+			err:  `unsupported -gha-format value: "yaml"`,
+		},
+		{
+			name: "-gha-format without -gha",
+			argv: func(t *testing.T) []string { return []string{"-gha-format", "json", "x.csv"} },
+			err:  "-gha-format only applies to -gha output",
+		},
+		{
+			name: "json key with -gha-format=step",
+			argv: func(t *testing.T) []string {
+				return []string{"-gha", "-gha-format", "step", csvFile(t, "name,value,key\ndb,{},password\n")}
+			},
+			err: `line 2: secret "db" has key set, which -gha-format=step doesn't support`,
+		},
+		{
+			name: "version id with -json",
+			argv: func(t *testing.T) []string { return []string{"-version-id", "-json", "x.csv"} },
+			err:  "-version-id cannot be used with",
+		},
+		{
+			name: "missing file",
+			argv: func(t *testing.T) []string { return []string{filepath.Join(t.TempDir(), "missing.csv")} },
+			err:  "no such file",
+		},
+		{
+			name: "missing name column",
+			argv: func(t *testing.T) []string { return []string{csvFile(t, "names,value\ndb,x\n")} },
+			err:  `missing required columns "name" (did you mean "names"?)`,
+		},
+		{
+			name: "duplicate names",
+			argv: func(t *testing.T) []string { return []string{csvFile(t, "name,value\ndb,x\ndb,y\n")} },
+			err:  "duplicate secret names",
+		},
+		{
+			name: "invalid name",
+			argv: func(t *testing.T) []string { return []string{csvFile(t, "name,value\nmy db,x\n")} },
+			err:  `line 2: secret name "my db" has invalid character ' '`,
+		},
+		{
+			name:  "existing secret",
+			argv:  func(t *testing.T) []string { return []string{csvFile(t, "name,value\nexisting,x\n")} },
+			err:   `create secret "existing": ResourceExistsException`,
+			calls: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c := newFakeClient()
+			c.add("existing", "old", "", map[string]string{})
+			out, err := runFake(t, c, tc.argv(t)...)
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Fatalf("got error %v, want one containing %q", err, tc.err)
+			}
+			if out != "" {
+				t.Errorf("failed run wrote output %q", out)
+			}
+			var calls int
+			for _, n := range c.calls {
+				calls += n
+			}
+			if tc.calls != (calls != 0) {
+				t.Errorf("made %d AWS calls", calls)
+			}
+		})
+	}
+}
+
+func TestCreateSecretsOrder(t *testing.T) {
+	var secrets []secret
+	for i := 0; i < 50; i++ {
+		secrets = append(secrets, secret{Name: fmt.Sprintf("s%02d", i)})
+	}
+	create := func(ctx context.Context, s secret) (outcome, error) {
+		// later secrets finish first
+		var i int
+		fmt.Sscanf(s.Name, "s%d", &i)
+		time.Sleep(time.Duration(len(secrets)-i) * 100 * time.Microsecond)
+		return outcome{arn: fakeARN(s.Name), status: statusCreated}, nil
+	}
+	var got []string
+	emit := func(s secret, o outcome) { got = append(got, s.Name) }
+	if err := createSecrets(context.Background(), 8, false, secrets, create, emit); err != nil {
+		t.Fatal(err)
+	}
+	var want []string
+	for _, s := range secrets {
+		want = append(want, s.Name)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("emitted in order %v, want %v", got, want)
+	}
+}
+
+func TestCreateSecretsKeepGoing(t *testing.T) {
+	secrets := []secret{{Name: "a"}, {Name: "b"}, {Name: "c"}, {Name: "d"}}
+	create := func(ctx context.Context, s secret) (outcome, error) {
+		if s.Name == "b" || s.Name == "d" {
+			return outcome{}, errors.New(s.Name + " failed")
+		}
+		return outcome{status: statusCreated}, nil
+	}
+	var got []string
+	emit := func(s secret, o outcome) { got = append(got, s.Name) }
+	err := createSecrets(context.Background(), 2, true, secrets, create, emit)
+	if err == nil || err.Error() != "b failed\nd failed" {
+		t.Errorf("got error %v, want both failures joined", err)
+	}
+	if want := []string{"a", "c"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("emitted %v, want %v", got, want)
+	}
+}
+
+func TestRunCreates(t *testing.T) {
+	c := newFakeClient()
+	file := writeFile(t, "secrets.csv", "name,value,description\nmyapp/db,secret1,Database\nmyapp/api,secret2,\n")
+	out, err := runFake(t, c, "-tag", "team=web", file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := fakeARN("myapp/db") + "\n" + fakeARN("myapp/api") + "\n"; out != want {
+		t.Errorf("got output %q, want %q", out, want)
+	}
+	var names []string
+	for name, s := range c.secrets {
+		names = append(names, name+"="+aws.StringValue(s.value)+" "+s.description+" team="+s.tags["team"])
+	}
+	sort.Strings(names)
+	want := []string{"myapp/api=secret2  team=web", "myapp/db=secret1 Database team=web"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("stored %q, want %q", names, want)
+	}
+}
+
+func TestRunVersionID(t *testing.T) {
+	for _, tc := range []struct {
+		flags []string
+		want  string
+	}{
+		{nil, fakeARN("db") + "\tv1\n"},
+		{[]string{"-with-name"}, "db\t" + fakeARN("db") + "\tv1\n"},
+		{[]string{"-env"}, `{"name":"DB","valueFrom":"` + fakeARN("db") + `","versionId":"v1"}` + "\n"},
+	} {
+		file := writeFile(t, "secrets.csv", "name,value\ndb,x\n")
+		out, err := runFake(t, newFakeClient(), append(append([]string{"-version-id"}, tc.flags...), file)...)
+		if err != nil {
+			t.Fatalf("%v: %v", tc.flags, err)
+		}
+		if out != tc.want {
+			t.Errorf("%v: got output %q, want %q", tc.flags, out, tc.want)
+		}
+	}
+}
+
+func TestCreateSecretsEmitsAfterFailure(t *testing.T) {
+	secrets := []secret{{Name: "a"}, {Name: "b"}, {Name: "c"}}
+	stored := make(chan struct{}, len(secrets))
+	create := func(ctx context.Context, s secret) (outcome, error) {
+		if s.Name == "a" {
+			// fail after other workers stored the rest
+			for i := 1; i < len(secrets); i++ {
+				<-stored
+			}
+			return outcome{}, errors.New("a failed")
+		}
+		stored <- struct{}{}
+		return outcome{status: statusCreated}, nil
+	}
+	var got []string
+	emit := func(s secret, o outcome) { got = append(got, s.Name) }
+	err := createSecrets(context.Background(), 3, false, secrets, create, emit)
+	if err == nil || err.Error() != "a failed" {
+		t.Errorf("got error %v, want a failed", err)
+	}
+	if want := []string{"b", "c"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("emitted %v, want %v", got, want)
+	}
+}
+
+func TestWithRetries(t *testing.T) {
+	defer func(d time.Duration) { retryDelay = d }(retryDelay)
+	retryDelay = time.Millisecond
+	throttled := awserr.New("ThrottlingException", "rate exceeded", nil)
+	other := awserr.New(secretsmanager.ErrCodeInternalServiceError, "boom", nil)
+	for _, tc := range []struct {
+		err        error
+		maxRetries int
+		calls      int
+	}{
+		{throttled, 0, 1},
+		{throttled, 2, 3},
+		{awserr.New("TooManyRequestsException", "slow down", nil), 1, 2},
+		{other, 2, 1},
+		{nil, 2, 1},
+	} {
+		var calls int
+		err := withRetries(context.Background(), tc.maxRetries, func() error {
+			calls++
+			return tc.err
+		})
+		if err != tc.err {
+			t.Errorf("%v with -max-retries %d: got error %v", tc.err, tc.maxRetries, err)
+		}
+		if calls != tc.calls {
+			t.Errorf("%v with -max-retries %d: made %d calls, want %d", tc.err, tc.maxRetries, calls, tc.calls)
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	var calls int
+	err := withRetries(ctx, 5, func() error {
+		calls++
+		cancel()
+		return throttled
+	})
+	if err != context.Canceled || calls != 1 {
+		t.Errorf("canceled: got error %v after %d calls, want %v after 1", err, calls, context.Canceled)
+	}
+}
+
+func TestCreateSecretUnsupportedExists(t *testing.T) {
+	c := newFakeClient()
+	c.add("db", "old", "", map[string]string{})
+	_, err := createSecret(context.Background(), c, secret{Name: "db", Value: "new"}, createOptions{exists: "ignore"})
+	if want := `unsupported -exists value: "ignore"`; err == nil || err.Error() != want {
+		t.Errorf("got error %v, want %s", err, want)
+	}
+}
+
+func TestCreateSecretInvalidRequest(t *testing.T) {
+	c := newFakeClient()
+	invalid := awserr.New(secretsmanager.ErrCodeInvalidRequestException, "scheduled for deletion, or not", nil)
+	c.errs["CreateSecret db"] = invalid
+	_, err := createSecret(context.Background(), c, secret{Name: "db", Value: "x"}, createOptions{exists: existsFail, restore: true})
+	if !errors.Is(err, invalid) {
+		t.Fatalf("got error %v, want %v", err, invalid)
+	}
+	if n := c.count("RestoreSecret"); n != 0 {
+		t.Errorf("made %d RestoreSecret calls for a secret that doesn't exist", n)
+	}
+}
+
+func TestCreateSecretRetriesThrottled(t *testing.T) {
+	defer func(d time.Duration) { retryDelay = d }(retryDelay)
+	retryDelay = time.Millisecond
+	c := newFakeClient()
+	c.errs["CreateSecret db"] = awserr.New("ThrottlingException", "rate exceeded", nil)
+	_, err := createSecret(context.Background(), c, secret{Name: "db", Value: "x"}, createOptions{exists: existsFail, maxRetries: 2})
+	if !isThrottling(err) {
+		t.Fatalf("got error %v", err)
+	}
+	if n := c.count("CreateSecret"); n != 3 {
+		t.Errorf("made %d CreateSecret calls, want 3", n)
+	}
+}
+
+func TestErrorsHideValues(t *testing.T) {
+	const material = "hunter2-S3CR3T"
+	for _, tc := range []struct {
+		name  string
+		file  string // input file name, format is detected by extension
+		input string
+		argv  []string
+	}{
+		{
+			name:  "bad base64",
+			file:  "secrets.csv",
+			input: "name,value_base64\ndb," + material + "!!\n",
+		},
+		{
+			name:  "JSON syntax error",
+			file:  "secrets.json",
+			input: `{"name":"db","value":"` + material + `"` + material + `}`,
+		},
+		{
+			name:  "JSON syntax error in value",
+			file:  "secrets.json",
+			input: `{"name":"db","value":` + material + `}`,
+		},
+		{
+			name:  "over-size value",
+			file:  "secrets.csv",
+			input: "name,value\ndb," + material + "\n",
+			argv:  []string{"-max-value-size", "8"},
+		},
+		{
+			name:  "over-size binary value",
+			file:  "secrets.csv",
+			input: "name,value_base64\ndb," + base64.StdEncoding.EncodeToString([]byte(material)) + "\n",
+			argv:  []string{"-max-value-size", "8"},
+		},
+		{
+			name:  "expand failure",
+			file:  "secrets.csv",
+			input: "name,value\ndb," + material + "${AWS_ADD_SECRETS_UNDEFINED}\n",
+			argv:  []string{"-expand"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var logs strings.Builder
+			log.SetOutput(&logs)
+			defer log.SetOutput(io.Discard)
+			argv := append(append([]string{"-verbose"}, tc.argv...), writeFile(t, tc.file, tc.input))
+			_, err := runFake(t, newFakeClient(), argv...)
+			if err == nil {
+				t.Fatal("invalid input accepted")
+			}
+			if strings.Contains(err.Error(), material) {
+				t.Errorf("error %q contains secret value", err)
+			}
+			if strings.Contains(logs.String(), material) {
+				t.Errorf("log %q contains secret value", logs.String())
+			}
+		})
+	}
+}
+
+func TestSecretFormatHidesValue(t *testing.T) {
+	const material = "hunter2-S3CR3T"
+	s := secret{Name: "db", Value: material}
+	for _, format := range []string{"%v", "%+v", "%#v", "%s"} {
+		for _, v := range []interface{}{s, &s} {
+			if got := fmt.Sprintf(format, v); strings.Contains(got, material) {
+				t.Errorf("%s of %T: %q contains secret value", format, v, got)
+			}
+		}
+	}
+}
+
+func TestRunLogsOutcomes(t *testing.T) {
+	defer func(level int) { logLevel = level }(logLevel)
+	logLevel = levelNormal
+	defer log.SetOutput(io.Discard)
+	file := writeFile(t, "secrets.csv", "name,value,overwrite\na,1,\nb,2,\nc,3,yes\n")
+	for _, format := range []string{"-with-name", "-env", "-env-array", "-dotenv", "-cfn", "-json"} {
+		var logs strings.Builder
+		log.SetOutput(&logs)
+		c := newFakeClient()
+		c.add("b", "old", "", map[string]string{})
+		c.add("c", "old", "", map[string]string{})
+		if _, err := runFake(t, c, "-exists", "skip", format, file); err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		for _, want := range []string{
+			`secret "a" created`,
+			`secret "b" skipped`,
+			`secret "c" updated`,
+			"created: 1, updated: 1, replaced: 0, skipped: 1, failed: 0",
+		} {
+			if !strings.Contains(logs.String(), want) {
+				t.Errorf("%s: log %q doesn't have %q", format, logs.String(), want)
+			}
+		}
+	}
+}
+
+func TestRunEnvOrder(t *testing.T) {
+	input := "name,value,env_name\n"
+	var want []string
+	for i := 0; i < 40; i++ {
+		input += fmt.Sprintf("app/s%02d,value%d,VAR_%02d\n", i, i, i)
+		want = append(want, fmt.Sprintf("VAR_%02d=%s", i, fakeARN(fmt.Sprintf("app/s%02d", i))))
+	}
+	file := writeFile(t, "secrets.csv", input)
+	type record struct{ Name, ValueFrom string }
+	for _, format := range []string{"-env", "-env-array"} {
+		t.Run(format, func(t *testing.T) {
+			c := newFakeClient()
+			rnd := rand.New(rand.NewSource(1))
+			for i := 0; i < 40; i++ {
+				c.delays[fmt.Sprintf("app/s%02d", i)] = time.Duration(rnd.Intn(5000)) * time.Microsecond
+			}
+			out, err := runFake(t, c, "-concurrency", "8", format, file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var records []record
+			if format == "-env-array" {
+				err = json.Unmarshal([]byte(out), &records)
+			} else {
+				dec := json.NewDecoder(strings.NewReader(out))
+				for err == nil {
+					var r record
+					if err = dec.Decode(&r); err == nil {
+						records = append(records, r)
+					}
+				}
+				if err == io.EOF {
+					err = nil
+				}
+			}
+			if err != nil {
+				t.Fatalf("decoding %q: %v", out, err)
+			}
+			var got []string
+			for _, r := range records {
+				got = append(got, r.Name+"="+r.ValueFrom)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("got records\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+			}
+		})
+	}
+}
+
+func TestParseCSVQuotedCRLF(t *testing.T) {
+	const input = "name,value\r\n# a \"quoted\r\ndb,\"line1\r\nline2\"\r\nweb,x\r\n"
+	for _, lazy := range []bool{false, true} {
+		secrets, err := parseCSV(strings.NewReader(input), "", readOptions{comment: '#', lazyQuotes: lazy})
+		if err != nil {
+			t.Fatalf("lazy quotes %v: %v", lazy, err)
+		}
+		want := []string{"line1\r\nline2", "x"}
+		if lazy {
+			want[0] = "line1\nline2"
+		}
+		var got []string
+		for _, s := range secrets {
+			got = append(got, s.Value)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("lazy quotes %v: got values %q, want %q", lazy, got, want)
+		}
+	}
+}
+
+func TestExportRoundTrip(t *testing.T) {
+	c := newFakeClient()
+	values := map[string]string{
+		"comma": "a,b,c",
+		"quote": `say "hi", then ""leave""`,
+		"crlf":  "line1\r\nline2\r\n",
+		"lines": "line1\rline2\nline3\r\r\n",
+		"space": " padded ",
+	}
+	for name, v := range values {
+		c.add(name, v, "about "+name+", quoted \"too\"", map[string]string{})
+	}
+	binary := []byte{0, 1, '\r', '\n', 0xff, ','}
+	c.add("binary", "", "", map[string]string{}).value = nil
+	c.secrets["binary"].binary = binary
+	var buf strings.Builder
+	if err := exportSecrets(context.Background(), c, &buf, "", false); err != nil {
+		t.Fatal(err)
+	}
+	secrets, err := parseCSV(strings.NewReader(buf.String()), "", readOptions{})
+	if err != nil {
+		t.Fatalf("reading back %q: %v", buf.String(), err)
+	}
+	if len(secrets) != len(values)+1 {
+		t.Fatalf("read back %d secrets from %q, want %d", len(secrets), buf.String(), len(values)+1)
+	}
+	for _, s := range secrets {
+		if s.Name == "binary" {
+			if !bytes.Equal(s.binary, binary) || s.Value != "" {
+				t.Errorf("binary secret read back as %q, %q", s.binary, s.Value)
+			}
+			continue
+		}
+		if s.Value != values[s.Name] {
+			t.Errorf("secret %q read back with value %q, want %q", s.Name, s.Value, values[s.Name])
+		}
+		if want := "about " + s.Name + ", quoted \"too\""; s.Description != want {
+			t.Errorf("secret %q read back with description %q, want %q", s.Name, s.Description, want)
+		}
+	}
+}
+
+func TestParseCSVLazyQuotes(t *testing.T) {
+	const input = "name,value\ndb,say \"hi\"\napi,\"quoted \"\"inner\"\" part\"\n"
+	if _, err := parseCSV(strings.NewReader(input), "", readOptions{}); err == nil {
+		t.Error("bare quote accepted without lazy quotes")
+	}
+	secrets, err := parseCSV(strings.NewReader(input), "", readOptions{lazyQuotes: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"db": `say "hi"`, "api": `quoted "inner" part`}
+	got := make(map[string]string)
+	for _, s := range secrets {
+		got[s.Name] = s.Value
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got values %q, want %q", got, want)
+	}
+}
+
+func TestFixEnvName(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		fixed  string
+		strict string // error with strict set, none if empty
+	}{
+		{name: "DB_PASSWORD", fixed: "DB_PASSWORD"},
+		{name: "_1", fixed: "_1"},
+		{name: "DB_PASSWORD\n", fixed: "DB_PASSWORD", strict: `invalid character '\n'`},
+		{name: "DB_\r\nPASSWORD", fixed: "DB_PASSWORD", strict: `invalid character '\r'`},
+		{name: "1_TOKEN", fixed: "_1_TOKEN", strict: "starts with a digit"},
+		{name: "\n1_TOKEN", fixed: "_1_TOKEN", strict: `invalid character '\n'`},
+		{name: "KEY🔑", fixed: "KEY_", strict: `invalid character '🔑'`},
+		{name: "🔑KEY", fixed: "_KEY", strict: `invalid character '🔑'`},
+		{name: "DB-PASSWORD", fixed: "DB_PASSWORD", strict: `invalid character '-'`},
+		{name: "ÜBER VAR", fixed: "_BER_VAR", strict: `invalid character 'Ü'`},
+	} {
+		fixed, err := fixEnvName(tc.name, false)
+		if err != nil || fixed != tc.fixed {
+			t.Errorf("fixEnvName(%q, false) = %q, %v, want %q", tc.name, fixed, err, tc.fixed)
+		}
+		fixed, err = fixEnvName(tc.name, true)
+		switch {
+		case tc.strict == "" && (err != nil || fixed != tc.name):
+			t.Errorf("fixEnvName(%q, true) = %q, %v, want it unchanged", tc.name, fixed, err)
+		case tc.strict != "" && (err == nil || !strings.Contains(err.Error(), tc.strict)):
+			t.Errorf("fixEnvName(%q, true) = %q, %v, want error containing %q", tc.name, fixed, err, tc.strict)
+		}
+	}
+	if _, err := fixEnvName("\r\n", false); err == nil {
+		t.Error("fixEnvName accepted name with only control characters")
+	}
+}
+
+func TestLimitNameLengths(t *testing.T) {
+	const max = 20
+	for _, n := range []int{max - 1, max, max + 1, maxNameLength + 1} {
+		name := strings.Repeat("a", n)
+		secrets := []secret{{Name: name, line: 2}}
+		err := limitNameLengths(secrets, max, false)
+		switch {
+		case n <= max && err != nil:
+			t.Errorf("%d characters: %v", n, err)
+		case n > max && err == nil:
+			t.Errorf("%d characters: name accepted", n)
+		}
+		if err := limitNameLengths(secrets, max, true); err != nil {
+			t.Fatal(err)
+		}
+		got := secrets[0].Name
+		if n <= max {
+			if got != name {
+				t.Errorf("%d characters: name changed to %q", n, got)
+			}
+			continue
+		}
+		if len(got) != max {
+			t.Errorf("%d characters: truncated to %q, %d characters long", n, got, len(got))
+		}
+		if !strings.HasPrefix(got, name[:max-truncatedHashLength-1]+"-") {
+			t.Errorf("%d characters: truncated to %q, which doesn't keep its start", n, got)
+		}
+		// variable name is derived from the original name
+		if want := strings.ToUpper(name); secrets[0].EnvName != want {
+			t.Errorf("%d characters: variable name became %q, want %q", n, secrets[0].EnvName, want)
+		}
+	}
+	// names differing past the limit stay distinct
+	long := strings.Repeat("a", max)
+	if a, b := truncateName(long+"1", max), truncateName(long+"2", max); a == b {
+		t.Errorf("distinct names truncated to the same %q", a)
+	}
+	if a, b := truncateName(long+"1", max), truncateName(long+"1", max); a != b {
+		t.Errorf("same name truncated to %q and %q", a, b)
+	}
+}
+
+func TestRunNameLengthWithPrefixAndSuffix(t *testing.T) {
+	// "db" fits alone, but "myapp/db-prod" is 13 characters long
+	file := writeFile(t, "secrets.csv", "name,value\ndb,x\n")
+	for _, tc := range []struct {
+		max  int
+		name string // created, none if it's an error
+	}{
+		{max: 14, name: "myapp/db-prod"},
+		{max: 13, name: "myapp/db-prod"},
+		{max: 12},
+	} {
+		c := newFakeClient()
+		_, err := runFake(t, c, "-prefix", "myapp", "-suffix", "-prod", "-max-name-length", strconv.Itoa(tc.max), file)
+		if tc.name == "" {
+			if err == nil || !strings.Contains(err.Error(), `secret name "myapp/db-prod" is longer than 12 characters`) {
+				t.Errorf("-max-name-length %d: got error %v", tc.max, err)
+			}
+		} else if err != nil {
+			t.Errorf("-max-name-length %d: %v", tc.max, err)
+		} else if _, ok := c.secrets[tc.name]; !ok {
+			t.Errorf("-max-name-length %d: secret %q not created", tc.max, tc.name)
+		}
+	}
+	c := newFakeClient()
+	if _, err := runFake(t, c, "-prefix", "myapp", "-suffix", "-prod", "-max-name-length", "12", "-truncate-names", file); err != nil {
+		t.Fatal(err)
+	}
+	for name := range c.secrets {
+		if len(name) != 12 || !strings.HasPrefix(name, "mya-") {
+			t.Errorf("created secret %q, want it truncated to 12 characters", name)
+		}
+	}
+}
+
+func TestNormalizeNewlines(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "key.pem"), []byte("-----BEGIN KEY-----\r\nMIIB\r\n-----END KEY-----\r\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	input := `[
+		{"name":"crlf","value":"a\r\nb\r\n"},
+		{"name":"cr","value":"a\rb\r"},
+		{"name":"mixed","value":"a\r\r\nb\n\rc"},
+		{"name":"lf","value":"a\nb\n"},
+		{"name":"file","value_file":"key.pem"}
+	]`
+	for _, tc := range []struct {
+		normalize bool
+		want      map[string]string
+	}{
+		{true, map[string]string{
+			"crlf":  "a\nb\n",
+			"cr":    "a\nb\n",
+			"mixed": "a\n\nb\n\nc",
+			"lf":    "a\nb\n",
+			"file":  "-----BEGIN KEY-----\nMIIB\n-----END KEY-----\n",
+		}},
+		{false, map[string]string{
+			"crlf":  "a\r\nb\r\n",
+			"cr":    "a\rb\r",
+			"mixed": "a\r\r\nb\n\rc",
+			"lf":    "a\nb\n",
+			"file":  "-----BEGIN KEY-----\r\nMIIB\r\n-----END KEY-----\r\n",
+		}},
+	} {
+		secrets, err := parseJSON(strings.NewReader(input), dir, readOptions{normNewlines: tc.normalize})
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := make(map[string]string)
+		for _, s := range secrets {
+			got[s.Name] = s.Value
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("normalize %v: got values %q, want %q", tc.normalize, got, tc.want)
+		}
+	}
+}
+
+func TestParseCSVHeaderCase(t *testing.T) {
+	for _, header := range []string{
+		"name,value,description",
+		"Name,Value,Description",
+		"NAME,VALUE,DESCRIPTION",
+		" name , Value\t,  DESCRIPTION  ",
+		`"Name ","  value","Description"`,
+	} {
+		secrets, err := parseCSV(strings.NewReader(header+"\ndb,secret,the db\n"), "", readOptions{})
+		if err != nil {
+			t.Errorf("header %q: %v", header, err)
+			continue
+		}
+		if len(secrets) != 1 || secrets[0].Name != "db" || secrets[0].Value != "secret" || secrets[0].Description != "the db" {
+			t.Errorf("header %q: got secrets %#v", header, secrets)
+		}
+	}
+}
+
+func TestParseCSVDescriptionColumn(t *testing.T) {
+	for _, tc := range []struct {
+		input string
+		cols  []string
+		json  bool
+		desc  string
+		value string
+	}{
+		{input: "name,value,notes\ndb,x,n\n", value: "x"},
+		{input: "name,password,notes\ndb,x,n\n", json: true, value: `{"password":"x","notes":"n"}`},
+		{input: "name,value,description,notes\ndb,x,d,n\n", cols: []string{"notes"}, desc: "n", value: "x"},
+		{input: "name,password,description,notes\ndb,x,d,n\n", cols: []string{"notes"}, json: true, desc: "n", value: `{"password":"x"}`},
+		{input: "name,value,Notes\ndb,x,n\n", cols: []string{"desc", "notes"}, desc: "n", value: "x"},
+		{input: "name,value,notes,desc\ndb,x,n,d\n", cols: []string{"desc", "notes"}, desc: "d", value: "x"},
+	} {
+		secrets, err := parseCSV(strings.NewReader(tc.input), "", readOptions{descColumns: tc.cols, jsonSecret: tc.json})
+		if err != nil {
+			t.Errorf("%q with columns %q: %v", tc.input, tc.cols, err)
+			continue
+		}
+		if s := secrets[0]; s.Description != tc.desc || s.Value != tc.value {
+			t.Errorf("%q with columns %q: got description %q and value %q, want %q and %q",
+				tc.input, tc.cols, s.Description, s.Value, tc.desc, tc.value)
+		}
+	}
+}
+
+func TestParseCSVHeaderCaseJSONSecret(t *testing.T) {
+	secrets, err := parseCSV(strings.NewReader(" NAME , Password ,user\ndb,secret,admin\n"), "", readOptions{jsonSecret: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// JSON keys keep the case of the header, without surrounding spaces
+	if want := `{"Password":"secret","user":"admin"}`; len(secrets) != 1 || secrets[0].Value != want {
+		t.Errorf("got secrets %#v, want one with value %s", secrets, want)
+	}
+}
+
+func TestReadSecretsBOM(t *testing.T) {
+	gz := func(s string) string {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		io.WriteString(zw, s)
+		if err := zw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		return buf.String()
+	}
+	const csvInput = utf8BOM + "name,value\ndb,secret\n"
+	const jsonInput = utf8BOM + `[{"name":"db","value":"secret"}]`
+	for _, tc := range []struct {
+		file, content string
+	}{
+		{"secrets.csv", csvInput},
+		{"secrets.json", jsonInput},
+		{"secrets.csv.gz", gz(csvInput)},
+		{"secrets.json.gz", gz(jsonInput)},
+		{"no-bom.csv.gz", gz("name,value\ndb,secret\n")},
+	} {
+		c := newFakeClient()
+		if _, err := runFake(t, c, writeFile(t, tc.file, tc.content)); err != nil {
+			t.Errorf("%s: %v", tc.file, err)
+			continue
+		}
+		if s, ok := c.secrets["db"]; !ok || aws.StringValue(s.value) != "secret" {
+			t.Errorf("%s: secret not created from the input", tc.file)
+		}
+	}
+}
+
+func TestRunDescription(t *testing.T) {
+	for _, tc := range []struct {
+		name, input string
+		want        map[string]*string
+	}{
+		{
+			name:  "no column",
+			input: "name,value\ndb,x\n",
+			want:  map[string]*string{"db": nil},
+		},
+		{
+			name:  "empty cells",
+			input: "name,value,description\ndb,x,\napi,y,The API\n",
+			want:  map[string]*string{"db": nil, "api": aws.String("The API")},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c := newFakeClient()
+			if _, err := runFake(t, c, writeFile(t, "secrets.csv", tc.input)); err != nil {
+				t.Fatal(err)
+			}
+			got := make(map[string]*string)
+			for _, in := range c.creates {
+				got[*in.Name] = in.Description
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got descriptions %s, want %s", awsutil.Prettify(got), awsutil.Prettify(tc.want))
+			}
+		})
+	}
+}
+
+func TestCheckEmptyNames(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		envName string
+		empty   bool
+	}{
+		{name: "123/456", empty: true},
+		{name: "myapp/123", empty: true},
+		{name: "2024", empty: true},
+		{name: "myapp/-./", empty: true},
+		{name: "123/db", empty: false},
+		{name: "123/456", envName: "NUMBERS", empty: false},
+	} {
+		secrets := []secret{{Name: "ok/name"}, {Name: tc.name, EnvName: tc.envName, line: 3}}
+		for _, check := range []struct {
+			kind string
+			name func(*secret) string
+		}{
+			{"variable name", (*secret).varName},
+			{"logical ID", (*secret).cfnID},
+		} {
+			err := checkEmptyNames(secrets, check.kind, check.name)
+			switch {
+			case tc.empty && err == nil:
+				t.Errorf("secret %q with an empty %s accepted", tc.name, check.kind)
+			case tc.empty && !strings.Contains(err.Error(), fmt.Sprintf("line 3: secret %q maps to an empty %s", tc.name, check.kind)):
+				t.Errorf("secret %q: got error %v", tc.name, err)
+			case !tc.empty && err != nil:
+				t.Errorf("secret %q: %v", tc.name, err)
+			}
+		}
+	}
+}
+
+func TestRunEmptyVarName(t *testing.T) {
+	for _, format := range []string{"-env", "-env-array", "-cfn", "-gha"} {
+		c := newFakeClient()
+		_, err := runFake(t, c, format, writeFile(t, "secrets.csv", "name,value\nmyapp/db,x\n123/456,y\n"))
+		if err == nil || !strings.Contains(err.Error(), `secret "123/456" maps to an empty`) {
+			t.Errorf("%s: got error %v", format, err)
+		}
+		if len(c.creates) != 0 {
+			t.Errorf("%s: created secrets before checking names", format)
+		}
+	}
+}
+
+func TestReadJSONKey(t *testing.T) {
+	for _, tc := range []struct {
+		format string
+		input  string
+		err    string
+	}{
+		{formatCSV, "name,value,key\ndb,{},password\n", ""},
+		{formatCSV, "name,value,json_key\ndb,{},password\n", ""},
+		{formatCSV, "name,value,key,json_key\ndb,{},password,password\n", "line 2: key and json_key cannot be set together"},
+		{formatCSV, "name,value,key\ndb,{},a:b\n", "line 2: key cannot contain colons"},
+		{formatJSON, `[{"name": "db", "value": "{}", "key": "password"}]`, ""},
+		{formatJSON, `[{"name": "db", "value": "{}", "json_key": "password"}]`, ""},
+	} {
+		secrets, err := parseSecrets(strings.NewReader(tc.input), "", readOptions{format: tc.format})
+		if tc.err != "" {
+			if err == nil || err.Error() != tc.err {
+				t.Errorf("%q: got error %v, want %q", tc.input, err, tc.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", tc.input, err)
+			continue
+		}
+		if e := newEcsSecret(secrets[0], "arn"); e.Value != "arn:password::" {
+			t.Errorf("%q: got valueFrom %q", tc.input, e.Value)
+		}
+	}
+}
+
+func TestRunGHA(t *testing.T) {
+	file := writeFile(t, "secrets.csv", "name,value,key\nmyapp/db.password,x,\nmyapp/creds,{},token\n")
+	db, creds := fakeARN("myapp/db.password"), fakeARN("myapp/creds")+":token::"
+	for _, tc := range []struct {
+		format string
+		want   string
+	}{
+		{ghaEnv, "DB_PASSWORD: \"" + db + "\"\nCREDS: \"" + creds + "\"\n"},
+		{ghaJSON, "{\n\t\"DB_PASSWORD\": \"" + db + "\",\n\t\"CREDS\": \"" + creds + "\"\n}\n"},
+	} {
+		out, err := runFake(t, newFakeClient(), "-gha", "-gha-format", tc.format, file)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.format, err)
+		}
+		if out != tc.want {
+			t.Errorf("%s: got output\n%s\nwant\n%s", tc.format, out, tc.want)
+		}
+	}
+	out, err := runFake(t, newFakeClient(), "-gha", "-gha-format", ghaStep, writeFile(t, "secrets.csv", "name,value\nmyapp/db.password,x\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "- uses: " + ghaAction + "\n  with:\n    secret-ids: |\n      DB_PASSWORD," + db + "\n"; out != want {
+		t.Errorf("step: got output\n%s\nwant\n%s", out, want)
+	}
+}
+
+func TestCreateSecretRequests(t *testing.T) {
+	for _, tc := range []struct {
+		exists   string
+		existing bool
+		want     map[string]int // calls by operation
+	}{
+		{existsFail, false, map[string]int{"CreateSecret": 1}},
+		{existsFail, true, map[string]int{"CreateSecret": 1}},
+		{existsSkip, false, map[string]int{"DescribeSecret": 1, "CreateSecret": 1}},
+		{existsSkip, true, map[string]int{"DescribeSecret": 1}},
+		{existsUpdate, false, map[string]int{"DescribeSecret": 1, "CreateSecret": 1}},
+		{existsUpdate, true, map[string]int{"DescribeSecret": 1, "PutSecretValue": 1}},
+		{existsReplace, false, map[string]int{"DescribeSecret": 1, "CreateSecret": 1}},
+		{existsReplace, true, map[string]int{"DescribeSecret": 1, "PutSecretValue": 1, "UpdateSecret": 1, "UntagResource": 1, "TagResource": 1}},
+		{existsMergeJSON, false, map[string]int{"DescribeSecret": 1, "CreateSecret": 1}},
+		{existsMergeJSON, true, map[string]int{"DescribeSecret": 1, "GetSecretValue": 1, "PutSecretValue": 1}},
+	} {
+		c := newFakeClient()
+		if tc.existing {
+			c.add("db", `{"user":"admin"}`, "old", map[string]string{"old": "1"})
+		}
+		s := secret{Name: "db", Value: `{"password":"x"}`, Description: "new",
+			Tags: []*secretsmanager.Tag{{Key: aws.String("new"), Value: aws.String("1")}}}
+		createSecret(context.Background(), c, s, createOptions{exists: tc.exists})
+		if !reflect.DeepEqual(c.calls, tc.want) {
+			t.Errorf("-exists=%s, existing %v: made requests %v, want %v", tc.exists, tc.existing, c.calls, tc.want)
+		}
+	}
+}
+
+func TestRunJSONReportOnFailure(t *testing.T) {
+	c := newFakeClient()
+	c.add("b", "old", "", map[string]string{})
+	// c is canceled once b fails, if it's started at all
+	c.delays["c"] = time.Minute
+	out, err := runFake(t, c, "-json", "-concurrency", "1", writeFile(t, "secrets.csv", "name,value\na,1\nb,2\nc,3\n"))
+	if err == nil {
+		t.Fatal("run with an existing secret succeeded")
+	}
+	var rep struct {
+		Secrets []struct{ Name, Status, Error string }
+		Summary map[string]int
+		Error   string
+	}
+	if err := json.Unmarshal([]byte(out), &rep); err != nil {
+		t.Fatalf("decoding report %q: %v", out, err)
+	}
+	var got []string
+	for _, s := range rep.Secrets {
+		got = append(got, s.Name+" "+s.Status)
+	}
+	if want := []string{"a created", "b failed"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("report has secrets %q, want %q", got, want)
+	}
+	if rep.Summary["created"] != 1 || rep.Summary["failed"] != 1 {
+		t.Errorf("report has summary %v", rep.Summary)
+	}
+	if rep.Error != err.Error() {
+		t.Errorf("report has error %q, want %q", rep.Error, err)
+	}
+}
+
+func TestRunRollbackAfterCreate(t *testing.T) {
+	boom := awserr.New(secretsmanager.ErrCodeInternalServiceError, "boom", nil)
+	c := newFakeClient()
+	c.errs["GetSecretValue b"] = boom
+	// c is canceled once b fails, if it's started at all
+	c.delays["c"] = time.Minute
+	_, err := runFake(t, c, "-rollback", "-verify", "-concurrency", "1", writeFile(t, "secrets.csv", "name,value\na,1\nb,2\nc,3\n"))
+	if !errors.Is(err, boom) {
+		t.Fatalf("got error %v, want verification failure", err)
+	}
+	var perr *partialError
+	if errors.As(err, &perr) {
+		t.Errorf("got partial error %v, though all secrets were rolled back", err)
+	}
+	if len(c.secrets) != 0 {
+		t.Errorf("%d secrets left after rollback", len(c.secrets))
+	}
+	if n := c.count("DeleteSecret"); n != 2 {
+		t.Errorf("made %d DeleteSecret calls, want 2", n)
+	}
+
+	// without -rollback the secret that failed verification is a change
+	c = newFakeClient()
+	c.errs["GetSecretValue a"] = boom
+	_, err = runFake(t, c, "-verify", writeFile(t, "secrets.csv", "name,value\na,1\n"))
+	if !errors.As(err, &perr) {
+		t.Errorf("got error %v, want a partial one", err)
+	}
+}
+
+func TestParseCSVSkipEmptyRows(t *testing.T) {
+	for _, tc := range []struct {
+		name, input string
+		opts        readOptions
+		names       []string
+		err         string
+	}{
+		{
+			name:  "empty",
+			input: "name,value,description\ndb,x,\n,,\n  ,  ,\n",
+			opts:  readOptions{skipEmpty: true, trim: true},
+			names: []string{"db"},
+		},
+		{
+			name:  "description only",
+			input: "name,value,description\n,,some description\ndb,x,\n",
+			opts:  readOptions{skipEmpty: true},
+			names: []string{"db"},
+		},
+		{
+			name:  "tags only",
+			input: "name,value,tags\ndb,x,\n,,team=web\n",
+			opts:  readOptions{skipEmpty: true},
+			names: []string{"db"},
+		},
+		{
+			name:  "spaces without trim",
+			input: "name,value\ndb,x\n , \n",
+			opts:  readOptions{skipEmpty: true},
+			err:   "line 3",
+		},
+		{
+			name:  "name only",
+			input: "name,value\ndb,x\napi,\n",
+			opts:  readOptions{skipEmpty: true},
+			err:   "line 3: empty secret value",
+		},
+		{
+			name:  "value only",
+			input: "name,value\ndb,x\n,y\n",
+			opts:  readOptions{skipEmpty: true},
+			err:   "line 3: empty secret name",
+		},
+		{
+			name:  "value_file only",
+			input: "name,value_file\n,db.txt\n",
+			opts:  readOptions{skipEmpty: true},
+			err:   "line 2: ",
+		},
+		{
+			name:  "JSON secret",
+			input: "name,user,password\ndb,admin,x\n,,\n",
+			opts:  readOptions{skipEmpty: true, jsonSecret: true},
+			names: []string{"db"},
+		},
+		{
+			name:  "JSON secret without name",
+			input: "name,user,password\ndb,admin,x\n,admin,\n",
+			opts:  readOptions{skipEmpty: true, jsonSecret: true},
+			err:   "line 3: empty secret name",
+		},
+		{
+			name:  "not skipped",
+			input: "name,value\ndb,x\n,\n",
+			err:   "line 3",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			secrets, err := parseCSV(strings.NewReader(tc.input), "", tc.opts)
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Fatalf("got error %v, want one containing %q", err, tc.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var names []string
+			for _, s := range secrets {
+				names = append(names, s.Name)
+			}
+			if !reflect.DeepEqual(names, tc.names) {
+				t.Errorf("got secrets %q, want %q", names, tc.names)
+			}
+		})
+	}
+}
+
+func TestTagValues(t *testing.T) {
+	for _, tc := range []struct {
+		tag, key, value string
+	}{
+		{"team=web", "team", "web"},
+		{"empty=", "empty", ""},
+	} {
+		var flagTags tagFlag
+		if err := flagTags.Set(tc.tag); err != nil {
+			t.Errorf("-tag %s: %v", tc.tag, err)
+			continue
+		}
+		var csvTags tagList
+		if err := csvTags.Set(tc.tag); err != nil {
+			t.Errorf("tags column %s: %v", tc.tag, err)
+			continue
+		}
+		for _, tags := range [][]*secretsmanager.Tag{flagTags, csvTags} {
+			if len(tags) != 1 || *tags[0].Key != tc.key || *tags[0].Value != tc.value {
+				t.Errorf("tag %s parsed as %s, want %s=%s", tc.tag, awsutil.Prettify(tags), tc.key, tc.value)
+			}
+		}
+	}
+	for _, tag := range []string{"team", "=web", "", "k=a=b", "token=c2VjcmV0=="} {
+		var flagTags tagFlag
+		if err := flagTags.Set(tag); err == nil {
+			t.Errorf("-tag %q accepted", tag)
+		}
+	}
+	// the tags column still allows = in values
+	var csvTags tagList
+	if err := csvTags.Set("k=a=b"); err != nil {
+		t.Fatal(err)
+	}
+	if len(csvTags) != 1 || *csvTags[0].Key != "k" || *csvTags[0].Value != "a=b" {
+		t.Errorf("tags column k=a=b parsed as %s", awsutil.Prettify(csvTags))
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// progressInterval is how often progress is logged when stderr is not
+// a terminal.
+const progressInterval = 10 * time.Second
+
+// progress reports the number of processed secrets to stderr. On a terminal
+// it updates a single line in place, otherwise it logs a line at most once per
+// progressInterval, and once all secrets are processed.
+type progress struct {
+	tty   bool
+	total int
+	done  int
+	last  time.Time // when progress was last logged
+}
+
+func newProgress(total int) *progress {
+	return &progress{
+		tty:   !logJSON && isTerminal(os.Stderr),
+		total: total,
+		last:  time.Now(),
+	}
+}
+
+// add accounts for a single processed secret. It's not safe for concurrent
+// use.
+func (p *progress) add() {
+	p.done++
+	if p.tty {
+		fmt.Fprintf(os.Stderr, "\rcreated %d/%d", p.done, p.total)
+		if p.done == p.total {
+			fmt.Fprintln(os.Stderr)
+		}
+		return
+	}
+	if now := time.Now(); p.done == p.total || now.Sub(p.last) >= progressInterval {
+		p.last = now
+		logInfo("created %d/%d", p.done, p.total)
+	}
+}
+
+// finish ends the in-place progress line if processing stopped early, so
+// that messages logged after it start on a new line.
+func (p *progress) finish() {
+	if p.tty && p.done != 0 && p.done != p.total {
+		fmt.Fprintln(os.Stderr)
+	}
+}
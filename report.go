@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// report is the JSON document written with the -json flag.
+type report struct {
+	Secrets []reportSecret `json:"secrets"`
+	Summary summary        `json:"summary"`
+	Error   string         `json:"error,omitempty"` // why the run stopped early
+}
+
+// reportSecret is the result of processing a single secret.
+type reportSecret struct {
+	Name      string `json:"name"`
+	ARN       string `json:"arn,omitempty"`
+	VersionID string `json:"versionId,omitempty"`
+	Status    string `json:"status"` // one of outcome statuses, or "failed"
+	Error     string `json:"error,omitempty"`
+}
+
+func newReportSecret(s secret, o outcome, err error) reportSecret {
+	r := reportSecret{Name: s.Name, ARN: o.arn, VersionID: o.versionID, Status: o.status}
+	if err != nil {
+		r = reportSecret{Name: s.Name, Status: "failed", Error: err.Error()}
+	}
+	return r
+}
+
+// writeReport writes the report to w. Results are in the order of secrets,
+// nil for the ones not processed because the run stopped early, which are
+// omitted. RunErr is the error that stopped the run, if any.
+func writeReport(w io.Writer, results []*reportSecret, sum summary, runErr error) error {
+	rep := report{Secrets: []reportSecret{}, Summary: sum}
+	if runErr != nil {
+		rep.Error = runErr.Error()
+	}
+	for _, r := range results {
+		if r != nil {
+			rep.Secrets = append(rep.Secrets, *r)
+		}
+	}
+	b, err := json.MarshalIndent(rep, "", "\t")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(b, '\n'))
+	return err
+}
+
+// MarshalJSON implements json.Marshaler.
+func (s summary) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Created  int `json:"created"`
+		Updated  int `json:"updated"`
+		Replaced int `json:"replaced"`
+		Skipped  int `json:"skipped"`
+		Failed   int `json:"failed"`
+	}{s.created, s.updated, s.replaced, s.skipped, s.failed})
+}
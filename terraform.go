@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// terraformNames derives unique Terraform resource names from secret names.
+type terraformNames map[string]bool
+
+// name returns a valid HCL identifier for the secret name, which is
+// different from all names returned before: "myapp/db.password" becomes
+// myapp_db_password, and repeated ones get _2, _3, etc. suffixes.
+func (seen terraformNames) name(secretName string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(secretName) {
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '_' {
+			b.WriteRune(r)
+			continue
+		}
+		b.WriteByte('_')
+	}
+	base := b.String()
+	if base == "" || base[0] >= '0' && base[0] <= '9' {
+		// identifiers must start with a letter or underscore
+		base = "secret_" + base
+	}
+	name := base
+	for i := 2; seen[name]; i++ {
+		name = base + "_" + strconv.Itoa(i)
+	}
+	seen[name] = true
+	return name
+}
+
+// writeTerraformResource writes aws_secretsmanager_secret resource stub for
+// the secret to w, preceded by a comment with the command to import it.
+func writeTerraformResource(w io.Writer, name string, s secret, arn string) {
+	fmt.Fprintf(w, "# terraform import aws_secretsmanager_secret.%s %s\n", name, arn)
+	fmt.Fprintf(w, "resource \"aws_secretsmanager_secret\" %q {\n", name)
+	// align attributes the way terraform fmt does
+	if s.Description == "" {
+		fmt.Fprintf(w, "  name = %s\n", hclString(s.Name))
+	} else {
+		fmt.Fprintf(w, "  name        = %s\n", hclString(s.Name))
+		fmt.Fprintf(w, "  description = %s\n", hclString(s.Description))
+	}
+	fmt.Fprint(w, "}\n\n")
+}
+
+// hclString returns s as a quoted HCL string literal. Unlike strconv.Quote it
+// only uses escapes supported by HCL, and escapes template sequences, so
+// that ${ and %{ are not interpreted.
+func hclString(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for i, r := range s {
+		switch {
+		case r == '"':
+			b.WriteString(`\"`)
+		case r == '\\':
+			b.WriteString(`\\`)
+		case r == '\n':
+			b.WriteString(`\n`)
+		case r == '\r':
+			b.WriteString(`\r`)
+		case r == '\t':
+			b.WriteString(`\t`)
+		case r < ' ' || r == 0x7f:
+			fmt.Fprintf(&b, `\u%04x`, r)
+		case (r == '$' || r == '%') && strings.HasPrefix(s[i+1:], "{"):
+			b.WriteRune(r)
+			b.WriteRune(r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}